@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// benchmarks are the programs golox bench runs. Each prints its result, so a mistake in the interpreter that skips
+// work shows up as a wrong answer rather than a fast time. Lox has no classes in golox, so method calls are the
+// built-in methods of arrays and strings
+var benchmarks = []struct {
+	name   string
+	source string
+	want   string // what the benchmark prints
+}{
+	{"fib", `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+print fib(25);
+`, "75025"},
+	{"binary-trees", `
+// a tree is an array holding its two children, which are nil for a leaf
+fun bottomUp(depth) {
+  if (depth == 0) return [nil, nil];
+  return [bottomUp(depth - 1), bottomUp(depth - 1)];
+}
+fun check(tree) {
+  if (tree[0] == nil) return 1;
+  return 1 + check(tree[0]) + check(tree[1]);
+}
+var total = 0;
+for (var i = 0; i < 10; i = i + 1) {
+  total = total + check(bottomUp(12));
+}
+print total;
+`, "81910"},
+	{"string-building", `
+var s = "";
+for (var i = 0; i < 100000; i = i + 1) {
+  s = s + "ab";
+}
+print len(s);
+`, "200000"},
+	{"method-calls", `
+var stack = [];
+var count = 0;
+for (var i = 0; i < 100000; i = i + 1) {
+  stack.push(i);
+  if (stack.length() > 10) count = count + stack.pop() % 7;
+  count = count + "x".upper().length();
+}
+print count;
+`, "399971"},
+}
+
+// runBench runs the bundled benchmarks, or those named, with the tree-walking interpreter, the only backend golox has,
+// and reports the best wall time and the heap allocations of each
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := flags.Int("runs", 3, "how many times to run each benchmark, reporting the fastest")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox bench [--runs n] [benchmark...]")
+		fmt.Print("Benchmarks:")
+		for _, b := range benchmarks {
+			fmt.Print(" " + b.name)
+		}
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *runs < 1 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+	selected := map[string]bool{}
+	for _, name := range flags.Args() {
+		selected[name] = true
+	}
+
+	status := 0
+	fmt.Printf("%-16s %12s %12s %12s\n", "benchmark", "time", "allocs", "bytes")
+	for _, b := range benchmarks {
+		if len(selected) > 0 && !selected[b.name] {
+			continue
+		}
+		delete(selected, b.name)
+		best := time.Duration(0)
+		var allocs, size uint64
+		var err error
+		for i := 0; i < *runs && err == nil; i++ {
+			var elapsed time.Duration
+			var a, by uint64
+			elapsed, a, by, err = runBenchmark(b.source, b.want)
+			if err == nil && (i == 0 || elapsed < best) {
+				best, allocs, size = elapsed, a, by
+			}
+		}
+		if err != nil {
+			printError(b.name + ": " + err.Error())
+			status = exitSoftware
+		} else {
+			fmt.Printf("%-16s %12s %12d %12s\n", b.name, best.Round(time.Microsecond), allocs, formatBytes(size))
+		}
+	}
+	for name := range selected {
+		printError(fmt.Sprintf("no benchmark \"%s\"", name))
+		status = exitUsage
+	}
+	os.Exit(status)
+}
+
+// runBenchmark lexes, parses, resolves and runs a benchmark's source, timing it and counting the heap allocations it
+// makes, and checks that it printed want
+func runBenchmark(source, want string) (time.Duration, uint64, uint64, error) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	program, err := parseSource("", source, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var out bytes.Buffer
+	global := lox.NewEnvironment(options)
+	global.SetStdout(&out)
+	setRunning(global)
+	if err := interpret(program, global); err != nil {
+		return 0, 0, 0, fmt.Errorf("%s", lox.FormatError(err, source))
+	}
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	if out.String() != want+"\n" {
+		return 0, 0, 0, fmt.Errorf("printed %q, expected %q", out.String(), want+"\n")
+	}
+	return elapsed, after.Mallocs - before.Mallocs, after.TotalAlloc - before.TotalAlloc, nil
+}
+
+// formatBytes shows a number of bytes in the largest unit that keeps it at least 1, eg 3.2MB
+func formatBytes(n uint64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", size, units[unit])
+}
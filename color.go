@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// ANSI escape codes for coloring errors, warnings, and the REPL's results
+const (
+	colorError   = "\x1b[31m" // red
+	colorWarning = "\x1b[33m" // yellow
+	colorResult  = "\x1b[36m" // cyan
+	colorReset   = "\x1b[0m"
+)
+
+// noColor is set by --no-color. useColor is whether errors and warnings, which go to stderr, are colored, and
+// useResultColor whether the REPL's results, which go to stdout, are
+var noColor bool
+var useColor bool
+var useResultColor bool
+
+// detectColor colors each stream only when it is a terminal, unless --no-color is given or the NO_COLOR environment
+// variable is set, so piped output and files never hold escape codes
+func detectColor() {
+	allowed := !noColor && os.Getenv("NO_COLOR") == ""
+	useColor = allowed && isTerminal(int(os.Stderr.Fd()))
+	useResultColor = allowed && isTerminal(int(os.Stdout.Fd()))
+}
+
+// colorize wraps s in an ANSI color when the stream it is written to is colored
+func colorize(color string, s string) string {
+	if (color == colorResult && !useResultColor) || (color != colorResult && !useColor) {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// printError prints an error to stderr, in red on a terminal, so it never ends up in output redirected to a file
+func printError(msg string) {
+	fmt.Fprintln(os.Stderr, colorize(colorError, msg))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// runCompile parses and resolves a script, then saves it in the compiled format, which golox runs without lexing or
+// parsing it again. The output goes next to the script, with its extension changed to .loxc, unless -o is given
+func runCompile(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := flags.String("o", "", "where to write the compiled script, by default the script's path ending in .loxc")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox compile script [-o file]")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+	// flags may also follow the script, as in golox compile script.lox -o script.loxc
+	path := flags.Arg(0)
+	parseFlags(flags, flags.Args()[1:])
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	bytes, err := readScript(path)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(exitNoInput)
+	}
+	warnings := &warningPrinter{src: string(bytes)}
+	program, err := parseSource(path, string(bytes), warnings)
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitDataErr)
+	}
+	if werror && warnings.count > 0 {
+		os.Exit(exitDataErr)
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(path, ".lox") + ".loxc"
+	}
+	if err := ioutil.WriteFile(*out, lox.Compile(program), 0644); err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+}
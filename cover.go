@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// coverage records which lines of a script ran, using lox.Hooks. Only lines with a statement on them count towards it
+type coverage struct {
+	path  string
+	src   string
+	lines map[int]int // how many statements ran on each line holding one
+}
+
+// newCoverage finds the lines of prgm with statements on them, including those in function bodies, none of which have
+// run yet
+func newCoverage(path, src string, prgm *lox.Node) *coverage {
+	c := &coverage{path: path, src: src, lines: map[int]int{}}
+	walkStatements(prgm, func(stmt *lox.Node) { c.lines[stmt.Line] = 0 })
+	return c
+}
+
+// walkStatements calls fn with each statement in prgm, other than blocks, in the order they appear in the source.
+// Expressions are searched too, for the bodies of anonymous functions
+func walkStatements(prgm *lox.Node, fn func(stmt *lox.Node)) {
+	lox.Walk(prgm, func(n *lox.Node) bool {
+		if n.IsStatement() && n.Type != lox.BlockNT && n.Line > 0 {
+			fn(n)
+		}
+		return true
+	})
+}
+
+func (c *coverage) hooks() lox.Hooks {
+	return lox.Hooks{
+		OnStatement: func(stmt *lox.Node, env *lox.Environment) {
+			if _, ok := c.lines[stmt.Line]; ok {
+				c.lines[stmt.Line]++
+			}
+		},
+	}
+}
+
+// covered returns how many lines have statements, and how many of those ran
+func (c *coverage) covered() (lines, ran int) {
+	for _, hits := range c.lines {
+		if hits > 0 {
+			ran++
+		}
+	}
+	return len(c.lines), ran
+}
+
+// summary writes the number of lines that ran and the lines that didn't
+func (c *coverage) summary(w io.Writer) {
+	lines, ran := c.covered()
+	percent := 100.0
+	if lines > 0 {
+		percent = float64(ran) * 100 / float64(lines)
+	}
+	fmt.Fprintf(w, "\nCoverage: %d of %d lines (%.1f%%)\n", ran, lines, percent)
+
+	missed := []string{}
+	for _, line := range c.sortedLines() {
+		if c.lines[line] == 0 {
+			missed = append(missed, fmt.Sprint(line))
+		}
+	}
+	if len(missed) > 0 {
+		fmt.Fprintf(w, "Lines not run: %s\n", strings.Join(missed, ", "))
+	}
+}
+
+func (c *coverage) sortedLines() []int {
+	lines := []int{}
+	for line := range c.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// writeAnnotated writes the script with how many statements ran on each line before it, "#####" for lines that never
+// ran, or "-" for lines without statements
+func (c *coverage) writeAnnotated(w io.Writer) {
+	for i, text := range strings.Split(strings.TrimSuffix(c.src, "\n"), "\n") {
+		count := "-"
+		if hits, ok := c.lines[i+1]; ok && hits == 0 {
+			count = "#####"
+		} else if ok {
+			count = fmt.Sprint(hits)
+		}
+		fmt.Fprintf(w, "%8s | %5d | %s\n", count, i+1, text)
+	}
+}
+
+// writeLCOV writes the coverage as an LCOV tracefile, which tools like genhtml and editor plugins can display
+func (c *coverage) writeLCOV(w io.Writer) {
+	path := c.path
+	if path == "-" {
+		path = "stdin"
+	} else if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	fmt.Fprintf(w, "TN:\nSF:%s\n", path)
+	for _, line := range c.sortedLines() {
+		fmt.Fprintf(w, "DA:%d,%d\n", line, c.lines[line])
+	}
+	lines, ran := c.covered()
+	fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", lines, ran)
+}
+
+// report writes the summary to stderr, and the coverage to coverPath if it is set: as an LCOV tracefile if the name ends
+// in .info or .lcov, otherwise as annotated source
+func (c *coverage) report() {
+	c.summary(os.Stderr)
+	if coverPath == "" {
+		return
+	}
+	f, err := os.Create(coverPath)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	defer f.Close()
+	if ext := filepath.Ext(coverPath); ext == ".info" || ext == ".lcov" {
+		c.writeLCOV(f)
+	} else {
+		c.writeAnnotated(f)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jheredos/golox/lox"
+)
+
+const debugHelp = `Commands:
+  break|b [file:]line   stop before the first statement on a line
+  delete|d [file:]line  remove a breakpoint
+  step|s                run the next statement, stopping inside functions it calls
+  next|n                run the next statement, including any functions it calls
+  continue|c            run until a breakpoint or the end of the script
+  stack|bt              show the functions being called
+  print|p name          show a variable's value
+  scope                 show the variables in every scope, from the global one inwards
+  list|l                show the source around the current line
+  quit|q                stop the script and exit`
+
+// debugger runs a script a statement at a time from lox.Hooks, stopping at breakpoints or after a step to read
+// commands from the user
+type debugger struct {
+	path   string
+	source []string
+	editor *lineEditor
+
+	breakpoints map[int]bool
+	firstOnLine map[int]*lox.Node // the statement a breakpoint on each line stops at, the one starting furthest left
+	line        int               // line of the statement about to run
+	depth       int               // how many calls are in progress
+	// where to stop next: at any statement when stepping, at one no deeper than stopDepth for next, or only at
+	// breakpoints when continuing
+	stepping  bool
+	stopDepth int
+}
+
+// runDebug runs a script under the debugger, stopping before its first statement
+func runDebug(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: golox debug script")
+		os.Exit(exitUsage)
+	}
+	path := args[0]
+	bytes, err := readScript(path)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(exitNoInput)
+	}
+	warnings := &warningPrinter{src: string(bytes)}
+	program, err := parseSource(path, string(bytes), warnings)
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitDataErr)
+	}
+
+	d := &debugger{
+		path:        path,
+		source:      strings.Split(string(bytes), "\n"),
+		editor:      newLineEditor(""),
+		breakpoints: map[int]bool{},
+		firstOnLine: map[int]*lox.Node{},
+		stepping:    true,
+	}
+	walkStatements(program, func(stmt *lox.Node) {
+		if first := d.firstOnLine[stmt.Line]; first == nil || stmt.Column < first.Column {
+			d.firstOnLine[stmt.Line] = stmt
+		}
+	})
+	if lox.IsCompiled(bytes) {
+		d.source = nil
+	}
+	global := lox.NewEnvironment(options)
+	global.SetStderr(os.Stdout) // so scopes are shown along with the rest of the debugger's output
+	global.SetScriptPath(path)
+	setRunning(global)
+	global.SetHooks(d.hooks())
+	fmt.Println(`Stopped before the first statement. Type "help" for commands`)
+
+	err = interpret(program, global)
+	if exit, ok := err.(*lox.ExitError); ok {
+		fmt.Printf("Script exited with status %d\n", exit.Code)
+		os.Exit(exit.Code)
+	}
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitSoftware)
+	}
+	fmt.Println("Script finished")
+}
+
+func (d *debugger) hooks() lox.Hooks {
+	return lox.Hooks{
+		OnStatement: func(stmt *lox.Node, env *lox.Environment) {
+			if stmt.Line == 0 || stmt.Type == lox.BlockNT {
+				return
+			}
+			d.line = stmt.Line
+			if d.stepping && d.depth <= d.stopDepth || d.breakpoints[stmt.Line] && d.isFirstOnLine(stmt) {
+				d.stop(env)
+			}
+		},
+		OnCall: func(name string, args []*lox.Node) {
+			d.depth++
+		},
+		OnReturn: func(name string, value *lox.Node) {
+			d.depth--
+		},
+	}
+}
+
+func (d *debugger) isFirstOnLine(stmt *lox.Node) bool {
+	first := d.firstOnLine[stmt.Line]
+	// a script's final expression statement is run as a return statement made from it, with the same expression
+	return first == stmt || first != nil && first.Type == lox.ExprStmtNT && first.Right == stmt.Right
+}
+
+// stop shows where the script is and reads commands until one of them resumes it
+func (d *debugger) stop(env *lox.Environment) {
+	d.showLine(d.line)
+	for {
+		cmd, err := d.editor.ReadLine("(debug) ")
+		if err != nil {
+			os.Exit(0) // Ctrl+D or Ctrl+C
+		}
+		d.editor.AddHistory(cmd)
+		fields := strings.Fields(cmd)
+		if len(fields) == 0 {
+			continue
+		}
+		arg := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), fields[0]))
+
+		switch fields[0] {
+		case "step", "s":
+			d.stepping, d.stopDepth = true, math.MaxInt32
+			return
+		case "next", "n":
+			d.stepping, d.stopDepth = true, d.depth
+			return
+		case "continue", "c":
+			d.stepping = false
+			return
+		case "break", "b":
+			if line, ok := d.parseLocation(arg); ok {
+				d.breakpoints[line] = true
+				fmt.Printf("Breakpoint at line %d\n", line)
+			}
+		case "delete", "d":
+			if line, ok := d.parseLocation(arg); ok && d.breakpoints[line] {
+				delete(d.breakpoints, line)
+			} else if ok {
+				printError(fmt.Sprintf("no breakpoint at line %d", line))
+			}
+		case "stack", "bt":
+			fmt.Printf("  at line %d\n", d.line)
+			for _, fn := range env.CallStack() {
+				fmt.Printf("  in %s\n", fn)
+			}
+		case "print", "p":
+			d.printVariable(env, arg)
+		case "scope":
+			env.PrintScope()
+		case "list", "l":
+			for line := d.line - 3; line <= d.line+3; line++ {
+				d.showLine(line)
+			}
+		case "help", "h":
+			fmt.Println(debugHelp)
+		case "quit", "q":
+			os.Exit(0)
+		default:
+			printError(fmt.Sprintf("unknown command \"%s\", type \"help\" for commands", fields[0]))
+		}
+	}
+}
+
+// parseLocation reads a breakpoint's line, given alone or after the script's path as file:line
+func (d *debugger) parseLocation(loc string) (int, bool) {
+	if i := strings.LastIndex(loc, ":"); i >= 0 {
+		file := loc[:i]
+		if file != d.path && file != filepath.Base(d.path) {
+			printError(fmt.Sprintf("no script \"%s\" is being debugged, only %s", file, d.path))
+			return 0, false
+		}
+		loc = loc[i+1:]
+	}
+	line, err := strconv.Atoi(loc)
+	if err != nil || line < 1 {
+		printError("expected a line number, eg break 12 or break " + filepath.Base(d.path) + ":12")
+		return 0, false
+	}
+	return line, true
+}
+
+// printVariable shows the value of the variable called name where the script has stopped
+func (d *debugger) printVariable(env *lox.Environment, name string) {
+	if val, ok := env.Lookup(name); ok {
+		fmt.Printf("%s = %s\n", name, val.ToString())
+		return
+	}
+	printError(fmt.Sprintf("no variable \"%s\" here", name))
+}
+
+// showLine prints a line of the script, marking the one about to run
+func (d *debugger) showLine(line int) {
+	if line < 1 || line > len(d.source) {
+		if line == d.line {
+			fmt.Printf("-> line %d\n", line) // compiled scripts have no source to show
+		}
+		return
+	}
+	marker := "  "
+	if line == d.line {
+		marker = "->"
+	} else if d.breakpoints[line] {
+		marker = " *"
+	}
+	fmt.Printf("%s %5d | %s\n", marker, line, d.source[line-1])
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errorLine finds the line an error is reported on, in golox's form, eg "Runtime error [E0401] on line 3, column 7",
+// or jlox's, where "[line 3]" follows a runtime error's message or starts a compile error
+var errorLine = regexp.MustCompile(`^\w+ error (\[\w+\] )?on line (\d+)|^\[line (\d+)\]`)
+
+// runDiffTest runs every .lox file in a directory through golox and compares its output with a reference: either the
+// output of another Lox interpreter given with --reference, or the file's .expected fixture, eg from jlox. Interpreters
+// word their errors differently, so only the lines errors are reported on are compared: those on the reference's
+// stderr, or in the file's .expected-errors fixture, if it has one
+func runDiffTest(args []string) {
+	flags := flag.NewFlagSet("difftest", flag.ExitOnError)
+	reference := flags.String("reference", "", "command for a reference interpreter, eg \"jlox\"; otherwise each script's .expected file is used")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox difftest [--reference cmd] dir")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	scripts, err := filepath.Glob(filepath.Join(flags.Arg(0), "*.lox"))
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	sort.Strings(scripts)
+
+	failed := 0
+	for _, script := range scripts {
+		var want, wantErrors string
+		if *reference != "" {
+			want, wantErrors = runScript(strings.Fields(*reference), script)
+		} else {
+			expected, err := ioutil.ReadFile(script + ".expected")
+			if err != nil {
+				fmt.Printf("SKIP %s: no .expected file\n", script)
+				continue
+			}
+			want = string(expected)
+			expectedErrors, _ := ioutil.ReadFile(script + ".expected-errors") // no file means no errors
+			wantErrors = string(expectedErrors)
+		}
+		got, gotErrors := runScript([]string{self}, script)
+
+		if line, diff := firstDifference(want, got); diff != "" {
+			failed++
+			fmt.Printf("FAIL %s, line %d:\n%s", script, line, diff)
+		} else if w, g := errorLines(wantErrors), errorLines(gotErrors); w != g {
+			failed++
+			fmt.Printf("FAIL %s, errors:\n\twant: %s\n\tgot:  %s\n", script, w, g)
+		} else {
+			fmt.Printf("ok   %s\n", script)
+		}
+	}
+
+	fmt.Printf("%d of %d scripts diverged\n", failed, len(scripts))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runScript runs an interpreter command on a script and returns what it printed to stdout and to stderr. Failing scripts are still compared, since their output up to the error matters
+func runScript(command []string, script string) (string, string) {
+	var out, errs bytes.Buffer
+	cmd := exec.Command(command[0], append(command[1:], script)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &errs
+	cmd.Run()
+	return out.String(), errs.String()
+}
+
+// errorLines describes the lines of the errors reported in an interpreter's stderr, eg "line 3", or "none"
+func errorLines(stderr string) string {
+	lines := []string{}
+	seen := map[string]bool{}
+	for _, text := range strings.Split(stderr, "\n") {
+		m := errorLine.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		line := m[2] + m[3]
+		if n, err := strconv.Atoi(line); err == nil && !seen[line] {
+			seen[line] = true
+			lines = append(lines, "line "+strconv.Itoa(n))
+		}
+	}
+	if len(lines) == 0 {
+		return "none"
+	}
+	return strings.Join(lines, ", ")
+}
+
+// firstDifference compares outputs line by line, describing the first line where they differ
+func firstDifference(want string, got string) (int, string) {
+	wantLines := strings.Split(strings.TrimRight(want, "\n"), "\n")
+	gotLines := strings.Split(strings.TrimRight(got, "\n"), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		w, g := "<end of output>", "<end of output>"
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return i + 1, fmt.Sprintf("\twant: %s\n\tgot:  %s\n", w, g)
+		}
+	}
+	return 0, ""
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// runFmt formats each script in the canonical Lox style, printing the result, or with -w writing it back to the
+// script, or with -d printing how the script would change
+func runFmt(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the formatted source back to each script instead of printing it")
+	diff := flags.Bool("d", false, "print a diff of the changes formatting would make instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox fmt [-w | -d] script...")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() == 0 || *write && *diff {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		bytes, err := readScript(path)
+		if err != nil {
+			printError(err.Error())
+			status = exitNoInput
+			continue
+		}
+		formatted, err := lox.Format(string(bytes))
+		if err != nil {
+			printError(path + ": " + lox.FormatError(err, string(bytes)))
+			status = exitDataErr
+			continue
+		}
+
+		switch {
+		case *write && formatted != string(bytes):
+			if err := ioutil.WriteFile(path, []byte(formatted), 0644); err != nil {
+				printError(err.Error())
+				status = 1
+			}
+		case *diff:
+			fmt.Print(unifiedDiff(path, string(bytes), formatted))
+		case !*write:
+			fmt.Print(formatted)
+		}
+	}
+	os.Exit(status)
+}
+
+// diffContext is how many unchanged lines are shown around each change in a diff
+const diffContext = 3
+
+// unifiedDiff describes the changes from before to after in the unified diff format, or returns "" if there are none
+func unifiedDiff(path, before, after string) string {
+	a := strings.SplitAfter(before, "\n")
+	b := strings.SplitAfter(after, "\n")
+	if a[len(a)-1] == "" {
+		a = a[:len(a)-1]
+	}
+	if b[len(b)-1] == "" {
+		b = b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// each line of the diff, with the lines it has reached in a and b
+	type diffLine struct {
+		text string
+		i, j int
+	}
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{" " + a[i], i, j})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{"-" + a[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{"+" + b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// find the next change, then take in the changes that follow within twice the context
+		for start < len(lines) && lines[start].text[0] == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+		end := start
+		for k := start; k < len(lines) && k <= end+2*diffContext; k++ {
+			if lines[k].text[0] != ' ' {
+				end = k
+			}
+		}
+		from, to := start-diffContext, end+diffContext+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", path, path)
+		}
+		removed, added := 0, 0
+		for _, l := range lines[from:to] {
+			if l.text[0] != '+' {
+				removed++
+			}
+			if l.text[0] != '-' {
+				added++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", lines[from].i+1, removed, lines[from].j+1, added)
+		for _, l := range lines[from:to] {
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
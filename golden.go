@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// runGolden parses every .lox file in a directory and compares its AST, rendered as S-expressions or JSON, with a golden
+// file saved next to it. With --update the golden files are rewritten instead, so parser changes show up as reviewable diffs
+func runGolden(args []string) {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	update := flags.Bool("update", false, "rewrite the golden files with the current output instead of comparing against them")
+	format := flags.String("format", "sexpr", "how to render the AST: \"sexpr\" or \"json\"")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox golden [--update] [--format sexpr|json] dir")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 || (*format != "sexpr" && *format != "json") {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	scripts, err := filepath.Glob(filepath.Join(flags.Arg(0), "*.lox"))
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	sort.Strings(scripts)
+
+	failed := 0
+	for _, script := range scripts {
+		golden := script + "." + *format
+		got, err := renderAST(script, *format)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %s\n", script, err)
+			continue
+		}
+
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+				printError(err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("wrote %s\n", golden)
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			fmt.Printf("SKIP %s: no golden file, run with --update to create it\n", script)
+			continue
+		}
+		if line, diff := firstDifference(string(want), got); diff != "" {
+			failed++
+			fmt.Printf("FAIL %s, line %d:\n%s", golden, line, diff)
+		} else {
+			fmt.Printf("ok   %s\n", script)
+		}
+	}
+
+	if *update {
+		return
+	}
+	fmt.Printf("%d of %d ASTs changed\n", failed, len(scripts))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// renderAST lexes and parses a script, returning its AST in the given format: sexpr, json or dot
+func renderAST(path string, format string) (string, error) {
+	bytes, err := readScript(path)
+	if err != nil {
+		return "", err
+	}
+	tokens, err := lox.Lex(string(bytes))
+	if err != nil {
+		return "", err
+	}
+	program, err := lox.Parse(tokens)
+	if err != nil {
+		return "", err
+	}
+	if format == "json" {
+		return program.ToJSON() + "\n", nil
+	}
+	if format == "dot" {
+		return program.ToDOT(), nil
+	}
+	return program.ToSExpression() + "\n", nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// how many lines of history are kept, in memory and in the history file
+const maxHistory = 1000
+
+// errLineCancelled is returned by ReadLine when the user presses Ctrl+C, abandoning what they had typed
+var errLineCancelled = errors.New("line cancelled")
+
+// lineEditor reads lines typed at the REPL. On a terminal, the line can be edited with the arrow keys, Home, End,
+// Backspace, Delete, and the Ctrl+A/E/K/U shortcuts, earlier lines recalled with the up and down arrows, and words
+// completed with Tab. Otherwise, eg when input is piped in, lines are read as they are
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	terminal bool
+
+	history     []string
+	historyPath string // where history is saved, or "" if it isn't
+
+	// complete lists the words that could be meant by the start of one, for Tab completion. It may be nil
+	complete func(prefix string) []string
+}
+
+func newLineEditor(historyPath string) *lineEditor {
+	e := &lineEditor{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		terminal:    isTerminal(int(os.Stdin.Fd())),
+		historyPath: historyPath,
+	}
+	e.loadHistory()
+	return e
+}
+
+// defaultHistoryPath is ~/.golox_history, or "" if there is no home directory
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".golox_history")
+}
+
+func (e *lineEditor) loadHistory() {
+	if e.historyPath == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(e.historyPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// AddHistory records an entry, to be recalled with the up arrow, in memory and at the end of the history file. Entries
+// typed over several lines are recorded as one, on a single line
+func (e *lineEditor) AddHistory(line string) {
+	line = strings.Replace(line, "\n", " ", -1)
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+	if e.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// ReadLine shows prompt and returns the line typed, without its newline. It returns io.EOF at the end of the input, or
+// when Ctrl+D is pressed on an empty line, and errLineCancelled when Ctrl+C is pressed
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	if !e.terminal {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil // the last line, without a newline
+		} else if err == io.EOF {
+			fmt.Fprintln(e.out) // so whatever is printed next starts on a line of its own
+		}
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		e.terminal = false
+		return e.ReadLine(prompt)
+	}
+	defer restore()
+	return e.edit(prompt)
+}
+
+// edit reads keys in raw mode until the line is entered or abandoned
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0                   // cursor position in buf
+	recalled := len(e.history) // index in history of the line being shown, or len(history) for the new line
+	draft := ""                // the new line, kept while looking through history
+	promptWidth := utf8.RuneCountInString(prompt)
+
+	redraw := func() {
+		// rewrite the whole line, clear anything after it, then move the cursor back to pos
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K\r", prompt, string(buf))
+		if col := promptWidth + pos; col > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dC", col)
+		}
+	}
+	show := func(i int) {
+		if recalled == len(e.history) {
+			draft = string(buf)
+		}
+		recalled = i
+		if i == len(e.history) {
+			buf = []rune(draft)
+		} else {
+			buf = []rune(e.history[i])
+		}
+		pos = len(buf)
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl+C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errLineCancelled
+		case 4: // Ctrl+D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 1: // Ctrl+A
+			pos = 0
+		case 5: // Ctrl+E
+			pos = len(buf)
+		case 11: // Ctrl+K
+			buf = buf[:pos]
+		case 21: // Ctrl+U
+			buf = buf[pos:]
+			pos = 0
+		case '\t':
+			buf, pos = e.completeWord(buf, pos)
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 27: // escape sequence, for arrows, Home, End and Delete
+			switch e.readEscape() {
+			case "[A", "OA": // up
+				if recalled > 0 {
+					show(recalled - 1)
+				}
+			case "[B", "OB": // down
+				if recalled < len(e.history) {
+					show(recalled + 1)
+				}
+			case "[C", "OC": // right
+				if pos < len(buf) {
+					pos++
+				}
+			case "[D", "OD": // left
+				if pos > 0 {
+					pos--
+				}
+			case "[H", "OH", "[1~", "[7~":
+				pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				pos = len(buf)
+			case "[3~": // Delete
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r < ' ' {
+				continue // other control characters
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+		}
+		redraw()
+	}
+}
+
+// completeWord completes the word before the cursor as far as every candidate for it agrees. When that adds nothing and
+// there are several candidates, they are listed below the line
+func (e *lineEditor) completeWord(buf []rune, pos int) ([]rune, int) {
+	if e.complete == nil {
+		return buf, pos
+	}
+	start := pos
+	for start > 0 && (unicode.IsLetter(buf[start-1]) || unicode.IsDigit(buf[start-1])) {
+		start--
+	}
+	if start == 1 && buf[0] == ':' {
+		start = 0 // a REPL command
+	}
+	prefix := string(buf[start:pos])
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return buf, pos
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(candidates) == 1 {
+		common += " "
+	}
+	if rest := []rune(strings.TrimPrefix(common, prefix)); len(rest) > 0 {
+		buf = append(buf[:pos], append(rest, buf[pos:]...)...)
+		return buf, pos + len(rest)
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	return buf, pos
+}
+
+// readEscape reads the rest of an escape sequence after ESC, eg "[A" for the up arrow
+func (e *lineEditor) readEscape() string {
+	first, _, err := e.in.ReadRune()
+	if err != nil || (first != '[' && first != 'O') {
+		return ""
+	}
+	seq := string(first)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return seq
+		}
+		seq += string(r)
+		if r < '0' || r > '9' {
+			// sequences end with a letter or "~", after any digits
+			return seq
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// runLint checks scripts for code that is legal but likely to be a mistake, printing each finding as a warning. Each
+// rule can be turned off with its flag, eg --shadow=false. It exits with status 1 if anything was found
+func runLint(args []string) {
+	rules := lox.DefaultLintRules()
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	unused := flags.Bool("unused", true, "report variables and functions that are never used (W0301, W0401)")
+	flags.BoolVar(&rules.Shadowing, "shadow", true, "report declarations hiding a variable in an enclosing scope (W0402)")
+	flags.BoolVar(&rules.SelfAssignment, "self-assign", true, "report variables assigned to themselves (W0403)")
+	flags.BoolVar(&rules.ConstantConditions, "constant-condition", true, "report conditions that are always true or false (W0404)")
+	flags.BoolVar(&rules.EmptyBlocks, "empty-block", true, "report empty blocks, other than function bodies (W0405)")
+	flags.BoolVar(&rules.LongParameterLists, "params", true, "report functions with more than --max-params parameters (W0406)")
+	flags.IntVar(&rules.MaxParams, "max-params", rules.MaxParams, "the most parameters a function may have")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox lint [rule flags] script...")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+	rules.UnusedGlobals = *unused
+
+	status := 0
+	for _, path := range flags.Args() {
+		bytes, err := readScript(path)
+		if err != nil {
+			printError(err.Error())
+			status = exitNoInput
+			continue
+		}
+		warnings := &lintReporter{warningPrinter{src: string(bytes), prefix: path + ": "}, *unused}
+		program, err := parseSource(path, string(bytes), warnings)
+		if err != nil {
+			printError(path + ": " + lox.FormatError(err, string(bytes)))
+			status = exitStatus(err)
+			continue
+		}
+		lox.Lint(program, rules, warnings)
+		if warnings.count > 0 && status == 0 {
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+// lintReporter prints warnings like warningPrinter, leaving out unused local variables if that rule is off
+type lintReporter struct {
+	warningPrinter
+	unused bool
+}
+
+func (r *lintReporter) Report(diag lox.Diagnostic) {
+	if diag.Code == lox.W0301 && !r.unused {
+		return
+	}
+	r.warningPrinter.Report(diag)
+}
@@ -0,0 +1,27 @@
+package lox
+
+// arenaBlock is how many nodes an Arena allocates at once
+const arenaBlock = 1024
+
+// Arena hands out the nodes of ASTs parsed with ParseInArena from large blocks, rather than allocating each node on its
+// own, so parsing large or many scripts makes far fewer heap objects for the garbage collector to track. A block stays
+// in memory until none of the nodes in it is reachable, so an arena suits scripts parsed and run together, eg by a
+// test runner. An Arena is not safe for use by several goroutines at once
+type Arena struct {
+	free []Node // what is left of the current block
+}
+
+// NewArena creates an empty arena
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// node returns a zeroed node from the current block, starting a new block when it is used up
+func (a *Arena) node() *Node {
+	if len(a.free) == 0 {
+		a.free = make([]Node, arenaBlock)
+	}
+	n := &a.free[0]
+	a.free = a.free[1:]
+	return n
+}
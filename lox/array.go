@@ -0,0 +1,155 @@
+package lox
+
+import "unicode/utf8"
+
+// interpretArrayLiteral evaluates each element of an array literal, in order, into a new array
+func (env *Environment) interpretArrayLiteral(expr *Node) *Node {
+	arr := &ArrayValue{Elements: []*Node{}}
+	for elem := expr.Right; elem != nil; elem = elem.Next {
+		arr.Elements = append(arr.Elements, env.interpretExpr(elem))
+	}
+	env.interp.allocate(elementSize * len(arr.Elements))
+	return &Node{Type: ArrayNT, Data: arr}
+}
+
+// interpretIndex returns the element of an array at an index, eg a[i], or the character of a string at an index as a
+// string of its own
+func (env *Environment) interpretIndex(expr *Node) *Node {
+	obj := env.interpretExpr(expr.Left)
+	index := env.interpretExpr(expr.Right)
+	switch obj.Type {
+	case ArrayNT:
+		arr := obj.Data.(*ArrayValue)
+		return arr.Elements[checkIndex(index, len(arr.Elements), false)]
+	case StringNT:
+		// strings are indexed by character rather than byte, so "héllo"[1] is "é"
+		chars := []rune(obj.Data.String())
+		return &Node{Type: StringNT, Data: StringValue(chars[checkIndex(index, len(chars), false)])}
+	}
+	panic(runtimeErrorf(E0414, "cannot index %s \"%s\"", obj.typeName(), obj.ToString()))
+}
+
+// interpretSlice returns part of an array or string, eg a[start:end], from start up to but not including end. A
+// missing start is the beginning and a missing end is the end, so a[:] copies the whole array
+func (env *Environment) interpretSlice(expr *Node) *Node {
+	obj := env.interpretExpr(expr.Left)
+	var length int
+	switch obj.Type {
+	case ArrayNT:
+		length = len(obj.Data.(*ArrayValue).Elements)
+	case StringNT:
+		length = utf8.RuneCountInString(obj.Data.String())
+	default:
+		panic(runtimeErrorf(E0414, "cannot slice %s \"%s\"", obj.typeName(), obj.ToString()))
+	}
+	start, end := 0, length
+	if expr.Right != nil {
+		start = checkIndex(env.interpretExpr(expr.Right), length, true)
+	}
+	if expr.Third != nil {
+		end = checkIndex(env.interpretExpr(expr.Third), length, true)
+	}
+	if start > end {
+		panic(runtimeErrorf(E0413, "slice start %d is after its end %d", start, end))
+	}
+
+	if obj.Type == StringNT {
+		s := string([]rune(obj.Data.String())[start:end])
+		env.interp.allocate(len(s))
+		return &Node{Type: StringNT, Data: StringValue(s)}
+	}
+	// copied, so changing the slice doesn't change the original array
+	arr := &ArrayValue{Elements: make([]*Node, end-start)}
+	env.interp.allocate(elementSize * len(arr.Elements))
+	copy(arr.Elements, obj.Data.(*ArrayValue).Elements[start:end])
+	return &Node{Type: ArrayNT, Data: arr}
+}
+
+// interpretIndexTarget evaluates the array and index of an IndexNT being assigned to, checking the index is in range
+func (env *Environment) interpretIndexTarget(expr *Node) (*ArrayValue, int) {
+	obj := env.interpretExpr(expr.Left)
+	index := env.interpretExpr(expr.Right)
+	if obj.Type == StringNT {
+		panic(runtimeErrorf(E0414, "cannot assign to a character of string \"%s\", strings can't be changed", obj.ToString()))
+	}
+	if obj.Type != ArrayNT {
+		panic(runtimeErrorf(E0414, "cannot index %s \"%s\"", obj.typeName(), obj.ToString()))
+	}
+	arr := obj.Data.(*ArrayValue)
+	return arr, checkIndex(index, len(arr.Elements), false)
+}
+
+// checkIndex converts an index into an array or string of the given length to an int, checking it is a whole number
+// in range. Slices may also use the length itself, for the end
+func checkIndex(index *Node, length int, slice bool) int {
+	if index.Type != NumberNT {
+		panic(runtimeErrorf(E0413, "index must be a number, got %s \"%s\"", index.typeName(), index.ToString()))
+	}
+	i := index.number()
+	limit := length
+	if slice {
+		limit++
+	}
+	if i != float32(int(i)) || i < 0 || int(i) >= limit {
+		panic(runtimeErrorf(E0413, "index %s out of range for length %d", index.ToString(), length))
+	}
+	return int(i)
+}
+
+// interpretSetIndex stores a value in an element of an array, eg a[i] = v, and returns the value. When the
+// assignment has an operation in Third, as for a[i] += v, it is applied to the element's current value first
+func (env *Environment) interpretSetIndex(stmt *Node) *Node {
+	arr, i := env.interpretIndexTarget(stmt.Left)
+	val := env.interpretExpr(stmt.Right)
+	if op := stmt.Third; op != nil {
+		// values evaluate to themselves, so the operation can be run on them directly
+		val = env.interpretExpr(&Node{
+			Type:   op.Type,
+			Data:   op.Data,
+			Left:   arr.Elements[i],
+			Right:  val,
+			Line:   op.Line,
+			Column: op.Column,
+		})
+	}
+	arr.Elements[i] = val
+	return val
+}
+
+// iterate returns a function giving the elements of a collection one at a time, and false once there are none left.
+// Arrays give their elements, including any pushed while iterating, and strings give each character as a string
+func iterate(collection *Node) func() (*Node, bool) {
+	i := 0
+	switch collection.Type {
+	case ArrayNT:
+		arr := collection.Data.(*ArrayValue)
+		return func() (*Node, bool) {
+			if i >= len(arr.Elements) {
+				return nil, false
+			}
+			i++
+			return arr.Elements[i-1], true
+		}
+	case StringNT:
+		str := collection.Data.String()
+		return func() (*Node, bool) {
+			if i >= len(str) {
+				return nil, false
+			}
+			r, size := utf8.DecodeRuneInString(str[i:])
+			i += size
+			return &Node{Type: StringNT, Data: StringValue(r)}, true
+		}
+	}
+	panic(runtimeErrorf(E0415, "cannot iterate over %s \"%s\"", collection.typeName(), collection.ToString()))
+}
+
+func nativeLen(env *Environment, args []*Node) *Node {
+	switch args[0].Type {
+	case ArrayNT:
+		return numberNode(NumberValue(len(args[0].Data.(*ArrayValue).Elements)))
+	case StringNT:
+		return numberNode(NumberValue(utf8.RuneCountInString(args[0].Data.String())))
+	}
+	panic(runtimeErrorf(E0410, "len() expects an array or string, got %s \"%s\"", args[0].typeName(), args[0].ToString()))
+}
@@ -1,8 +1,11 @@
 package lox
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // Node represents a node in the AST. Left and Right refer to the next branches of the AST, and Type tells you what to expect in each place. Leaf nodes store the Token's Literal value in Node.Val
@@ -13,10 +16,36 @@ type Node struct {
 	Third *Node
 	Next  *Node
 	Data  Value
+
+	// where the node's token is in the source, counting from 1, set by Parse. Statements start at their first token,
+	// and operators, calls and property accesses at the operator, "(" or property name. 0 if the AST doesn't record it
+	Line   int
+	Column int
+
+	// comments around a statement, or at the end of a block or program, set by Parse. nil if there are none
+	Trivia *Trivia
+
+	native  nativeFn         // Go implementation of a CallableNT
+	closure *Environment     // scope a FunctionNT was declared in, which its calls are nested inside
+	builder *strings.Builder // holds the bytes of a StringNT made by concatenation, see concatenate
+
+	// set by Resolve on IdentifierNTs: how many scopes out the variable was declared, or globalDepth, and for local
+	// variables which slot of that scope holds it. The names declaring local variables, and parameters, are given
+	// depth 0 and the slot they are stored in
+	resolved bool
+	depth    int
+	slot     int
+	// set by Resolve on nodes that create a scope when they run, such as blocks and functions: the names of the local
+	// variables declared in the scope, one for each slot
+	locals []string
 }
 
-// Value wraps disparate values
-type Value []byte
+// Trivia holds the comments that belong with a statement, so tools such as golox fmt can write them back
+type Trivia struct {
+	Leading  []Comment // before the statement, on lines of their own
+	Trailing []Comment // inside the statement, or after it on its last line
+	Closing  []Comment // in a block or program, after its last statement
+}
 
 // NodeType represents the types of AST Nodes, from top-level program nodes to literals like Bool and Number
 type NodeType uint8
@@ -27,15 +56,20 @@ const (
 	DeclarationNT
 	VarDeclNT
 	FunDeclNT
+	LambdaNT // anonymous function expression, eg fun (a) { return a; }
 	FunctionNT
 	StmtNT
 	BlockNT
 	ReturnStmtNT
+	BreakStmtNT
+	ContinueStmtNT
 	ExprStmtNT
 	PrintStmtNT
-	WhileStmtNT // For loops are desugared into while loops
+	WhileStmtNT // For loops are desugared into while loops, with the increment as Third
+	ForInStmtNT // for (var x in collection), with the variable as Left, the collection as Right and the body as Third
 	IfStmtNT
 	AssignmentNT
+	ConditionalNT // cond ? a : b
 	LogicOrNT
 	LogicAndNT
 	EqualityNT
@@ -47,56 +81,96 @@ const (
 	ParamNT
 	CallNT
 	CallableNT
+	GetNT   // property access with "."
+	IndexNT // element access with "[]", eg a[i]
+	SliceNT // part of an array or string, eg a[start:end], with the start as Right and the end as Third
 	IdentifierNT
 	NumberNT
+	DecimalNT      // exact decimal, created with the decimal() native
+	ArrayLiteralNT // [a, b, c], with the element expressions connected by Next from Right
+	ArrayNT        // array value, created by evaluating an ArrayLiteralNT
 	StringNT
 	BoolNT
 	GroupNT
 	NilNT
 	EOFNT
+
+	// types added since compiled scripts were introduced come last, so the types above keep the numbers they are
+	// stored as
+	ImportStmtNT // import "path" as name, with the name as Left and the path, a StringNT, as Right
+	ModuleNT     // module value, created by running an imported file, with a *ModuleValue as Data
+	IncrementNT  // ++ or --, with the variable or element as Right for ++a, like UnaryNT, or as Left for a++
 )
 
-func (t Token) toValue() Value {
-	var val Value
-	switch t.Type {
-	case Number:
-		val = encodeLoxNumberFromString(t.Lexeme)
-	case String:
-		val = []byte(t.Lexeme)
-	case True:
-		val = []byte{1}
-	case False:
-		val = []byte{0}
-	default:
-		val = []byte(t.Lexeme)
-	}
-	return val
+var nodeTypeNames = map[NodeType]string{
+	ProgramNT:      "Program",
+	DeclarationNT:  "Declaration",
+	VarDeclNT:      "VarDecl",
+	FunDeclNT:      "FunDecl",
+	LambdaNT:       "Lambda",
+	FunctionNT:     "Function",
+	StmtNT:         "Stmt",
+	BlockNT:        "Block",
+	ReturnStmtNT:   "ReturnStmt",
+	BreakStmtNT:    "BreakStmt",
+	ContinueStmtNT: "ContinueStmt",
+	ExprStmtNT:     "ExprStmt",
+	PrintStmtNT:    "PrintStmt",
+	WhileStmtNT:    "WhileStmt",
+	ForInStmtNT:    "ForInStmt",
+	IfStmtNT:       "IfStmt",
+	AssignmentNT:   "Assignment",
+	ConditionalNT:  "Conditional",
+	LogicOrNT:      "LogicOr",
+	LogicAndNT:     "LogicAnd",
+	EqualityNT:     "Equality",
+	ComparisonNT:   "Comparison",
+	TermNT:         "Term",
+	FactorNT:       "Factor",
+	UnaryNT:        "Unary",
+	ArgNT:          "Arg",
+	ParamNT:        "Param",
+	CallNT:         "Call",
+	CallableNT:     "Callable",
+	GetNT:          "Get",
+	IndexNT:        "Index",
+	SliceNT:        "Slice",
+	IdentifierNT:   "Identifier",
+	NumberNT:       "Number",
+	DecimalNT:      "Decimal",
+	ArrayLiteralNT: "ArrayLiteral",
+	ArrayNT:        "Array",
+	StringNT:       "String",
+	BoolNT:         "Bool",
+	GroupNT:        "Group",
+	NilNT:          "Nil",
+	EOFNT:          "EOF",
+	ImportStmtNT:   "ImportStmt",
+	ModuleNT:       "Module",
+	IncrementNT:    "Increment",
 }
 
-func encodeBool(b bool) Value {
-	if b {
-		return []byte{1}
+// String names the NodeType, eg "WhileStmt"
+func (t NodeType) String() string {
+	if name, ok := nodeTypeNames[t]; ok {
+		return name
 	}
-	return []byte{0}
-}
-
-func encodeString(s string) Value {
-	return []byte(s)
+	return "Unknown"
 }
 
-func compareValues(a Value, b Value) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := 0; i < len(a); i++ {
-		if a[i] != b[i] {
-			return false
-		}
+func (t Token) toValue() Value {
+	switch t.Type {
+	case Number:
+		return NumberValue(parseLoxNumber(t.Lexeme))
+	case True:
+		return BoolValue(true)
+	case False:
+		return BoolValue(false)
 	}
-	return true
+	return StringValue(t.Lexeme)
 }
 
-func encodeLoxNumberFromString(s string) Value {
+func parseLoxNumber(s string) float32 {
 	var n float32 = 0
 	var dec float32 = 0
 
@@ -114,64 +188,57 @@ func encodeLoxNumberFromString(s string) Value {
 		}
 	}
 
-	return encodeLoxNumber(n)
+	return n
 }
 
-func encodeLoxNumber(n float32) Value {
-	f := math.Float32bits(n)
-	return []byte{
-		byte(f >> 24),
-		byte(f >> 16),
-		byte(f >> 8),
-		byte(f),
+// formatNumber is the canonical string form of a Lox number: integers have no decimal point, and other numbers use the fewest digits that represent them exactly
+func formatNumber(n float32) string {
+	switch {
+	case math.IsInf(float64(n), 1):
+		return "Infinity"
+	case math.IsInf(float64(n), -1):
+		return "-Infinity"
+	case math.IsNaN(float64(n)):
+		return "NaN"
 	}
+	return strconv.FormatFloat(float64(n), 'f', -1, 32)
 }
 
-func decodeLoxNumber(v Value) float32 {
-	var u uint32
-	for i := 0; i < 4; i++ {
-		u |= uint32(v[i]) << ((3 - i) * 8)
-	}
-	return math.Float32frombits(u)
+// jsonNode is the shape of a Node in ToJSON's output
+type jsonNode struct {
+	Type  string    `json:"type"`
+	Value string    `json:"value,omitempty"`
+	Left  *jsonNode `json:"left,omitempty"`
+	Right *jsonNode `json:"right,omitempty"`
+	Third *jsonNode `json:"third,omitempty"`
+	Next  *jsonNode `json:"next,omitempty"`
 }
 
-func trimNumber(s string) string {
-	for i := len(s) - 1; i > 0; i-- {
-		if s[i] != '0' {
-			if s[i] == '.' {
-				return s[:i]
-			}
-			return s[:i+1]
-		}
-	}
-	return s
+// ToJSON converts an AST into indented JSON, naming the type of each node and giving its data in printed form
+func (n *Node) ToJSON() string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(n.toJSONNode())
+	return strings.TrimSuffix(b.String(), "\n")
 }
 
-// ToSExpression converts an AST into parenthesized S-expressions
-func (n *Node) ToSExpression() string {
+func (n *Node) toJSONNode() *jsonNode {
 	if n == nil {
-		return ""
+		return nil
 	}
-	switch n.Type {
-	case NumberNT, StringNT, BoolNT, NilNT, ParamNT:
-		return n.ToString()
-	default:
-		s := "(" + n.ToString()
-		if n.Left != nil {
-			s += " " + n.Left.ToSExpression()
-		}
-		if n.Right != nil {
-			s += " " + n.Right.ToSExpression()
-		}
-		if n.Third != nil {
-			s += " " + n.Third.ToSExpression()
-		}
-		s += ")"
-		if n.Next == nil {
-			return s
-		}
-		return s + "\n -> " + n.Next.ToSExpression()
+	j := &jsonNode{
+		Type:  n.Type.String(),
+		Left:  n.Left.toJSONNode(),
+		Right: n.Right.toJSONNode(),
+		Third: n.Third.toJSONNode(),
+		Next:  n.Next.toJSONNode(),
+	}
+	if n.Data != nil {
+		j.Value = n.Data.String()
 	}
+	return j
 }
 
 // ToString represents a AST Node as a string
@@ -189,27 +256,51 @@ func (n *Node) ToString() string {
 	case FunDeclNT:
 		return "<function declaration \"" + n.Left.ToString() + "\">"
 	case FunctionNT:
-		return "<function object>"
+		return fmt.Sprintf("<fn %s(%d)>", n.functionName(), int(n.number()))
+	case LambdaNT:
+		return "<anonymous function>"
 	case BlockNT:
 		return "<block>"
 	case ReturnStmtNT:
 		return "<return>"
+	case BreakStmtNT:
+		return "<break>"
+	case ContinueStmtNT:
+		return "<continue>"
+	case ImportStmtNT:
+		return "<import \"" + n.Right.ToString() + "\">"
 	case WhileStmtNT:
 		return "<while>"
+	case ForInStmtNT:
+		return "<for in>"
 	case IfStmtNT:
 		return "<if>"
 	case AssignmentNT:
 		return "<assignment>"
+	case ConditionalNT:
+		return "<conditional>"
 	case LogicOrNT:
 		return "<or>"
 	case LogicAndNT:
 		return "<and>"
 	case ArgNT:
-		return "<argument" + string(n.Data) + ">"
+		return "<argument" + n.Data.String() + ">"
 	case CallNT:
+		if n.Left.Type != IdentifierNT {
+			// the callee is itself an expression, eg f(a)(b)
+			return "<call>"
+		}
 		return "<\"" + n.Left.ToString() + "\" call>"
 	case CallableNT:
-		return "<callable>"
+		return fmt.Sprintf("<native fn %s(%d)>", n.Left.ToString(), int(n.number()))
+	case GetNT:
+		return "<get \"" + n.Right.ToString() + "\">"
+	case IndexNT:
+		return "<index>"
+	case SliceNT:
+		return "<slice>"
+	case ArrayLiteralNT:
+		return "<array literal>"
 	case StmtNT:
 		return "<statement>"
 	case ExprStmtNT:
@@ -217,44 +308,75 @@ func (n *Node) ToString() string {
 	case PrintStmtNT:
 		return "print"
 	case EqualityNT:
-		return string(n.Data)
+		return n.Data.String()
 	case ComparisonNT:
-		return string(n.Data)
+		return n.Data.String()
 	case TermNT:
-		return string(n.Data)
+		return n.Data.String()
 	case FactorNT:
-		return string(n.Data)
+		return n.Data.String()
 	case UnaryNT:
-		return string(n.Data)
+		return n.Data.String()
 	case IdentifierNT, ParamNT:
-		return string(n.Data)
+		return n.Data.String()
 	case GroupNT:
 		return "<group>"
 	case EOFNT:
 		return "<end-of-file>"
-	case NumberNT:
-		return trimNumber(fmt.Sprintf("%f", decodeLoxNumber(n.Data)))
-	case BoolNT:
-		if n.Data[0] == 1 {
-			return "true"
-		}
-		return "false"
+	case DecimalNT, NumberNT, BoolNT, ArrayNT, ModuleNT:
+		return n.Data.String()
 	case NilNT:
 		return "nil"
 	default:
 		if n.Data != nil {
-			return string(n.Data)
+			return n.Data.String()
 		}
 		return "<unknown>"
 	}
 }
 
-func (n *Node) truthy() bool {
-	if n.Type == BoolNT && n.Data[0] == 0 {
+// typeName names the type of a runtime value, for error messages
+func (n *Node) typeName() string {
+	switch n.Type {
+	case NumberNT:
+		return "number"
+	case DecimalNT:
+		return "decimal"
+	case StringNT:
+		return "string"
+	case ArrayNT:
+		return "array"
+	case BoolNT:
+		return "bool"
+	case NilNT:
+		return "nil"
+	case FunctionNT, CallableNT:
+		return "function"
+	case ModuleNT:
+		return "module"
+	default:
+		return "<unknown>"
+	}
+}
+
+// truthy follows Lox's rules for truthiness: nil and false are falsy, and everything else is truthy. With Options.LooseTruthiness, 0 and "" are also falsy
+func (n *Node) truthy(opts Options) bool {
+	if n.Type == BoolNT && n.Data == BoolValue(false) {
 		return false
 	}
 	if n.Type == NilNT {
 		return false
 	}
+	if opts.LooseTruthiness {
+		if n.Type == NumberNT && n.number() == 0 {
+			return false
+		}
+		if n.Type == DecimalNT && n.Data.(DecimalValue).Rat.Sign() == 0 {
+			return false
+		}
+		if n.Type == StringNT && n.Data == StringValue("") {
+			return false
+		}
+	}
 	return true
 }
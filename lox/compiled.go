@@ -0,0 +1,197 @@
+package lox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Compiled scripts hold a parsed AST in a compact binary form, so a large program can be run without lexing and parsing
+// it again. golox walks the tree rather than running bytecode, so the tree is what is compiled. Files start with
+// compiledMagic and the format's version, followed by the program's root node. Nodes linked by Next are written one
+// after another, ending with a 0. Each is its type plus one, its data, its line and column, then its Left, Right and
+// Third nodes. Numbers are varints, except for NumberValues, which are the 4 bytes of the float32
+const compiledMagic = "LOXC"
+
+// CompiledVersion is the version of the compiled format written by Compile. LoadCompiled only reads this version, so
+// scripts must be compiled again after it changes
+const CompiledVersion = 1
+
+// kinds of data a compiled node holds
+const (
+	noData byte = iota
+	numberData
+	stringData
+	boolData
+	decimalData
+)
+
+// Compile converts a parsed program into the compiled format, for LoadCompiled to read back
+func Compile(prgm *Node) []byte {
+	buf := appendUvarint([]byte(compiledMagic), CompiledVersion)
+	return appendCompiledNode(buf, prgm)
+}
+
+// IsCompiled reports whether data starts like a compiled script, so a file can be recognized whatever its name
+func IsCompiled(data []byte) bool {
+	return len(data) >= len(compiledMagic) && string(data[:len(compiledMagic)]) == compiledMagic
+}
+
+// LoadCompiled reads a program written by Compile. Like a tree read by FromSExpression, it still needs resolving
+// before it runs
+func LoadCompiled(data []byte) (*Node, error) {
+	if !IsCompiled(data) {
+		return nil, fmt.Errorf("not a compiled Lox script")
+	}
+	r := &compiledReader{data: data, pos: len(compiledMagic)}
+	if version := r.uvarint(); version != CompiledVersion {
+		return nil, fmt.Errorf("script was compiled with format version %d, but this golox reads version %d: compile it again", version, CompiledVersion)
+	}
+	n := r.node()
+	if r.err == nil && r.pos < len(r.data) {
+		r.fail("unexpected data after the program")
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return n, nil
+}
+
+func appendCompiledNode(buf []byte, n *Node) []byte {
+	// statements are chained through Next, so the chain is followed in a loop rather than recursively
+	for ; n != nil; n = n.Next {
+		buf = appendUvarint(buf, uint64(n.Type)+1)
+		switch d := n.Data.(type) {
+		case NumberValue:
+			buf = append(buf, numberData)
+			var bits [4]byte
+			binary.LittleEndian.PutUint32(bits[:], math.Float32bits(float32(d)))
+			buf = append(buf, bits[:]...)
+		case StringValue:
+			buf = append(buf, stringData)
+			buf = appendCompiledString(buf, string(d))
+		case BoolValue:
+			buf = append(buf, boolData)
+			if d {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		case DecimalValue:
+			buf = append(buf, decimalData)
+			buf = appendCompiledString(buf, d.Rat.String())
+		default:
+			buf = append(buf, noData)
+		}
+		buf = appendUvarint(buf, uint64(n.Line))
+		buf = appendUvarint(buf, uint64(n.Column))
+		buf = appendCompiledNode(buf, n.Left)
+		buf = appendCompiledNode(buf, n.Right)
+		buf = appendCompiledNode(buf, n.Third)
+	}
+	return append(buf, 0) // ends the chain
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendCompiledString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+type compiledReader struct {
+	data []byte
+	pos  int
+	err  error // the first error found, after which reads return zero values
+}
+
+func (r *compiledReader) fail(format string, a ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("compiled script error at offset %d: %s", r.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+// node reads a chain of nodes linked by Next, returning the first
+func (r *compiledReader) node() *Node {
+	var first, prev *Node
+	for r.err == nil {
+		t := r.uvarint()
+		if t == 0 {
+			break
+		}
+		n := &Node{Type: NodeType(t - 1)}
+		switch r.byte() {
+		case noData:
+		case numberData:
+			if bits := r.bytes(4); bits != nil {
+				n.Data = NumberValue(math.Float32frombits(binary.LittleEndian.Uint32(bits)))
+			}
+		case stringData:
+			n.Data = StringValue(r.bytes(int(r.uvarint())))
+		case boolData:
+			n.Data = BoolValue(r.byte() == 1)
+		case decimalData:
+			s := string(r.bytes(int(r.uvarint())))
+			rat, ok := new(big.Rat).SetString(s)
+			if !ok {
+				r.fail("invalid decimal \"%s\"", s)
+				return nil
+			}
+			n.Data = DecimalValue{rat}
+		default:
+			r.fail("unknown kind of data")
+		}
+		n.Line = int(r.uvarint())
+		n.Column = int(r.uvarint())
+		n.Left = r.node()
+		n.Right = r.node()
+		n.Third = r.node()
+
+		if first == nil {
+			first = n
+		} else {
+			prev.Next = n
+		}
+		prev = n
+	}
+	return first
+}
+
+func (r *compiledReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, size := binary.Uvarint(r.data[r.pos:])
+	if size <= 0 {
+		r.fail("truncated or invalid number")
+		return 0
+	}
+	r.pos += size
+	return v
+}
+
+func (r *compiledReader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// bytes reads the next n bytes, or returns nil if there aren't that many
+func (r *compiledReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.fail("truncated script")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
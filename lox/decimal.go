@@ -0,0 +1,115 @@
+package lox
+
+import "math/big"
+
+// decimals that don't terminate, like 1/3, are printed rounded to this many places
+const decimalMaxPlaces = 20
+
+// isNumeric reports whether n is a number or a decimal
+func (n *Node) isNumeric() bool {
+	return n.Type == NumberNT || n.Type == DecimalNT
+}
+
+// toDecimal converts a number or decimal value to a big.Rat. Numbers are converted from their shortest printed form, so 0.1 becomes exactly 1/10
+func toDecimal(n *Node) (*big.Rat, bool) {
+	switch n.Type {
+	case DecimalNT:
+		return n.Data.(DecimalValue).Rat, true
+	case NumberNT:
+		return new(big.Rat).SetString(formatNumber(n.number()))
+	}
+	return nil, false
+}
+
+// formatDecimal prints a decimal exactly when it terminates, and rounded to decimalMaxPlaces otherwise
+func formatDecimal(r *big.Rat) string {
+	// a fraction in lowest terms terminates when its denominator has no prime factors besides 2 and 5
+	denom := new(big.Int).Set(r.Denom())
+	places := 0
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		count := 0
+		for new(big.Int).Mod(denom, f).Sign() == 0 {
+			denom.Div(denom, f)
+			count++
+		}
+		if count > places {
+			places = count
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		places = decimalMaxPlaces
+	}
+	return r.FloatString(places)
+}
+
+// interpretDecimalOp applies an arithmetic operator when either operand is a decimal
+func interpretDecimalOp(op string, left *Node, right *Node) *Node {
+	l, okL := toDecimal(left)
+	r, okR := toDecimal(right)
+	if !okL || !okR {
+		panic(runtimeErrorf(E0406, "operator \"%s\" undefined for %s \"%s\" and %s \"%s\"", op, left.typeName(), left.ToString(), right.typeName(), right.ToString()))
+	}
+	result := new(big.Rat)
+	switch op {
+	case "+":
+		result.Add(l, r)
+	case "-":
+		result.Sub(l, r)
+	case "*":
+		result.Mul(l, r)
+	case "/":
+		if r.Sign() == 0 {
+			panic(runtimeErrorf(E0408, "division by zero"))
+		}
+		result.Quo(l, r)
+	case "%":
+		if r.Sign() == 0 {
+			panic(runtimeErrorf(E0408, "division by zero"))
+		}
+		// l - r*q, where q is l/r truncated towards zero, so the result has the sign of l like it does for numbers
+		quo := new(big.Rat).Quo(l, r)
+		q := new(big.Int).Quo(quo.Num(), quo.Denom())
+		result.Sub(l, new(big.Rat).Mul(r, new(big.Rat).SetInt(q)))
+	}
+	return &Node{Type: DecimalNT, Data: DecimalValue{result}}
+}
+
+// interpretDecimalComparison compares two values when either is a decimal
+func interpretDecimalComparison(op string, left *Node, right *Node) *Node {
+	l, okL := toDecimal(left)
+	r, okR := toDecimal(right)
+	if !okL || !okR {
+		panic(runtimeErrorf(E0407, "cannot compare %s \"%s\" with %s \"%s\"", left.typeName(), left.ToString(), right.typeName(), right.ToString()))
+	}
+	cmp := l.Cmp(r)
+	var result bool
+	switch op {
+	case "<":
+		result = cmp < 0
+	case "<=":
+		result = cmp <= 0
+	case ">":
+		result = cmp > 0
+	case ">=":
+		result = cmp >= 0
+	}
+	return boolNode(result)
+}
+
+// nativeDecimal converts a number, or a string holding a decimal literal, into an exact decimal
+func nativeDecimal(env *Environment, args []*Node) *Node {
+	arg := args[0]
+	if arg.Type == StringNT {
+		r, ok := new(big.Rat).SetString(arg.Data.String())
+		if !ok {
+			panic(runtimeErrorf(E0410, "decimal() cannot convert \"%s\"", arg.ToString()))
+		}
+		return &Node{Type: DecimalNT, Data: DecimalValue{r}}
+	}
+	r, ok := toDecimal(arg)
+	if !ok {
+		panic(runtimeErrorf(E0410, "decimal() expects a number or string, got %s \"%s\"", arg.typeName(), arg.ToString()))
+	}
+	return &Node{Type: DecimalNT, Data: DecimalValue{r}}
+}
@@ -0,0 +1,696 @@
+package lox
+
+import "strings"
+
+// Code identifies a kind of error or warning, so it can be searched for and explained with golox explain. Codes never
+// change meaning once assigned: E01xx are lexing errors, E02xx parsing errors, E03xx errors found by Resolve, and
+// E04xx are runtime errors. Warnings are numbered the same way, starting with W
+type Code string
+
+// Error codes
+const (
+	E0101 Code = "E0101" // unexpected character
+	E0102 Code = "E0102" // unterminated string
+
+	E0201 Code = "E0201" // expected function name
+	E0202 Code = "E0202" // too many parameters or arguments
+	E0203 Code = "E0203" // expected ";"
+	E0204 Code = "E0204" // expected "("
+	E0205 Code = "E0205" // expected ")"
+	E0206 Code = "E0206" // expected function body
+	E0207 Code = "E0207" // expected "}"
+	E0208 Code = "E0208" // empty for loop
+	E0209 Code = "E0209" // malformed while statement
+	E0210 Code = "E0210" // malformed if statement
+	E0211 Code = "E0211" // invalid assignment target
+	E0212 Code = "E0212" // expected property name
+	E0213 Code = "E0213" // unexpected token
+	E0214 Code = "E0214" // "this" outside a method
+	E0215 Code = "E0215" // expected ":"
+	E0216 Code = "E0216" // expected "]"
+	E0217 Code = "E0217" // malformed import statement
+
+	E0301 Code = "E0301" // return outside a function
+	E0302 Code = "E0302" // local variable read in its own initializer
+	E0303 Code = "E0303" // break outside a loop
+	E0304 Code = "E0304" // continue outside a loop
+	E0305 Code = "E0305" // import outside the top level
+	E0306 Code = "E0306" // local variable or parameter declared twice in the same scope
+
+	E0400 Code = "E0400" // internal error
+	E0401 Code = "E0401" // undefined variable
+	E0402 Code = "E0402" // assignment to undeclared variable
+	E0403 Code = "E0403" // redeclared variable or function
+	E0404 Code = "E0404" // calling a value that isn't a function
+	E0405 Code = "E0405" // wrong number of arguments
+	E0406 Code = "E0406" // operator applied to the wrong types
+	E0407 Code = "E0407" // comparing mismatched types
+	E0408 Code = "E0408" // division by zero
+	E0409 Code = "E0409" // unknown property
+	E0410 Code = "E0410" // wrong type of argument to a native function
+	E0411 Code = "E0411" // argv() index out of range
+	E0412 Code = "E0412" // native function not implemented
+	E0413 Code = "E0413" // index out of range
+	E0414 Code = "E0414" // indexing a value that can't be indexed
+	E0415 Code = "E0415" // iterating over a value that isn't a collection
+	E0416 Code = "E0416" // error from a host function
+	E0417 Code = "E0417" // stack overflow
+	E0418 Code = "E0418" // internal error
+	E0419 Code = "E0419" // failed assertion
+	E0420 Code = "E0420" // imported file can't be read or has errors
+	E0421 Code = "E0421" // import cycle
+)
+
+// Warning codes
+const (
+	W0101 Code = "W0101" // malformed number literal
+
+	W0301 Code = "W0301" // unused local variable
+	W0302 Code = "W0302" // unreachable code
+	W0303 Code = "W0303" // if branch that never runs
+
+	W0401 Code = "W0401" // unused global variable or function
+	W0402 Code = "W0402" // shadowed variable
+	W0403 Code = "W0403" // self-assignment
+	W0404 Code = "W0404" // constant condition
+	W0405 Code = "W0405" // empty block
+	W0406 Code = "W0406" // too many parameters
+)
+
+// explanations describe each error code at length, with an example of code that causes it
+var explanations = map[Code]string{
+	E0101: `Unexpected character
+
+The lexer found a character that can't start any Lox token, such as "@", "#" or "$".
+
+    var price = $5;  // error: "$" isn't valid Lox
+
+Remove the character, or put it inside a string if it is meant to be text:
+
+    var price = "$5";`,
+
+	E0102: `Unterminated string
+
+A string was opened with '"' but the program ended before it was closed. Strings may span several lines, so the
+missing quote can be far from where the error is reported: it points to the line the string starts on.
+
+    print "hello;  // error: the string runs to the end of the file
+
+Close the string:
+
+    print "hello";`,
+
+	E0201: `Expected function name
+
+"fun" must be followed by the name of the function being declared.
+
+    fun (a, b) { return a + b; }  // error: no name
+
+Give the function a name:
+
+    fun add(a, b) { return a + b; }`,
+
+	E0202: `Too many parameters or arguments
+
+Functions may take at most 254 parameters, and calls may pass at most 254 arguments. Group related values together
+instead of passing them separately.`,
+
+	E0203: `Expected ";"
+
+Statements end with a semicolon. The error points to the line where the parser expected one.
+
+    var a = 1
+    print a;  // error: expected ";" after "1"
+
+Add the missing semicolon:
+
+    var a = 1;
+    print a;`,
+
+	E0204: `Expected "("
+
+Function declarations, "if", "while" and "for" need a parenthesized list after them.
+
+    if a > 1 print a;  // error: the condition must be in parentheses
+
+Wrap the condition or parameter list in parentheses:
+
+    if (a > 1) print a;`,
+
+	E0205: `Expected ")"
+
+A parenthesis opened for a group, a call's arguments, a parameter list, or a for loop's clauses wasn't closed.
+
+    print add(1, 2;  // error: missing ")"
+
+Close the parenthesis:
+
+    print add(1, 2);`,
+
+	E0206: `Expected function body
+
+A function's parameter list must be followed by its body, in braces.
+
+    fun greet(name) print name;  // error: body must be a block
+
+Put the body in a block:
+
+    fun greet(name) { print name; }`,
+
+	E0207: `Expected "}"
+
+A block, such as a function body or the body of a loop, wasn't closed before the end of the program.
+
+    fun greet(name) {
+      print name;
+    // error: missing "}"
+
+Close the block:
+
+    fun greet(name) {
+      print name;
+    }`,
+
+	E0208: `Empty for loop
+
+A for loop must have at least one of an initializer, a condition, an increment, or a body. A loop with none of them
+would do nothing forever. Use "while (true)" when a loop is meant to run until the program ends.`,
+
+	E0209: `Malformed while statement
+
+"while" must be followed by a condition in parentheses and then a statement to repeat.
+
+    while (i < 10)  // error: no body
+
+Add the body:
+
+    while (i < 10) i = i + 1;`,
+
+	E0210: `Malformed if statement
+
+"if" must be followed by a condition in parentheses, then a statement, and optionally "else" and another statement.
+
+    if (ready) else print "waiting";  // error: no statement before "else"
+
+Add the statement to run when the condition is true:
+
+    if (ready) print "go"; else print "waiting";`,
+
+	E0211: `Invalid assignment target
+
+Only variables and array elements can be assigned to. The left side of "=" must be a variable name, or an element
+of an array like a[i].
+
+    1 + 2 = 3;  // error
+    a + b = 3;  // error
+
+Assign to a variable or an element:
+
+    a = 3;
+    a[0] = 3;`,
+
+	E0212: `Expected property name
+
+"." must be followed by the name of a property or method.
+
+    print "hello".;  // error
+
+Name the method:
+
+    print "hello".upper();`,
+
+	E0213: `Unexpected token
+
+The parser found a token where it expected an expression, such as a value, a variable, or a parenthesized group.
+
+    var a = * 2;  // error: "*" can't start an expression
+
+Complete the expression:
+
+    var a = 3 * 2;`,
+
+	E0214: `"this" outside a method
+
+"this" refers to the instance a method was called on, so it can only be used inside a class's methods. golox doesn't
+support classes yet, so "this" can't be used anywhere.
+
+    fun greet() { print this.name; }  // error
+
+Pass the value as a parameter instead:
+
+    fun greet(person) { print person; }`,
+
+	E0215: `Expected ":"
+
+A conditional expression needs both branches: the value when the condition is truthy, then ":", then the value
+otherwise.
+
+    var label = count == 1 ? "item";  // error: no second branch
+
+Add the other branch:
+
+    var label = count == 1 ? "item" : "items";`,
+
+	E0216: `Expected "]"
+
+An array literal or an index wasn't closed with "]".
+
+    var a = [1, 2, 3;  // error
+    print a[0;         // error
+
+Close the bracket:
+
+    var a = [1, 2, 3];
+    print a[0];`,
+
+	E0217: `Malformed import statement
+
+"import" must be followed by the path of a file as a string, then optionally "as" and the name to give the module,
+then ";". Without "as", the module is named after its file, so a file whose name isn't a valid identifier needs one.
+
+    import lib/math.lox;                  // error: the path isn't a string
+    import "lib/string-utils.lox";        // error: string-utils isn't a name
+
+Quote the path, and name the module if its file name can't be used:
+
+    import "lib/math.lox";
+    import "lib/string-utils.lox" as strings;`,
+
+	E0301: `Return outside a function
+
+"return" ends a function call, so it can only be used inside a function's body. Use exit() to end the program early.
+
+    if (done) return;  // error at the top level of a script`,
+
+	E0302: `Local variable read in its own initializer
+
+A local variable isn't defined until its initializer has been evaluated, so the initializer can't refer to it.
+Usually this happens when shadowing a variable from an enclosing scope.
+
+    var a = 1;
+    {
+      var a = a + 1;  // error
+    }
+
+Give the new variable a different name:
+
+    var a = 1;
+    {
+      var b = a + 1;
+    }`,
+
+	E0303: `Break outside a loop
+
+"break" ends the innermost "while" or "for" loop, so it can only be used inside one. A function declared inside a
+loop can't break out of it: use "return" to end the function instead.
+
+    if (done) break;  // error when not inside a loop`,
+
+	E0304: `Continue outside a loop
+
+"continue" skips to the next iteration of the innermost "while" or "for" loop, so it can only be used inside one. A
+function declared inside a loop can't continue the loop: use "return" to end the function instead.
+
+    if (skip) continue;  // error when not inside a loop`,
+
+	E0305: `Import outside the top level
+
+A module is imported once for the whole file, so import statements can only be used at the top level of a script,
+outside any function or block.
+
+    fun area(r) {
+      import "lib/math.lox";  // error
+      return math.pi * r * r;
+    }
+
+Move the import to the top of the file:
+
+    import "lib/math.lox";
+
+    fun area(r) {
+      return math.pi * r * r;
+    }`,
+
+	E0306: `Local variable declared twice
+
+A block, function or loop declared two local variables with the same name, or a function has two parameters with the
+same name. The second would hide the first for the rest of the scope, which is almost always a mistake. Redeclaring a
+global is reported when the program runs instead, as E0403.
+
+    {
+      var a = 1;
+      var a = 2;  // error
+    }
+    fun add(a, a) { return a + a; }  // error
+
+Assign to the existing variable instead, or give the new one a different name:
+
+    {
+      var a = 1;
+      a = 2;
+    }
+    fun add(a, b) { return a + b; }`,
+
+	E0400: `Internal error
+
+The interpreter found an AST it doesn't know how to run. This is a bug in golox, or, when running a .sexpr file, a
+tree that the parser would never produce. Please report it along with the program that caused it.`,
+
+	E0401: `Undefined variable
+
+A variable was used before it was declared, or outside the scope it was declared in. The error suggests a similar
+name when there is one.
+
+    var count = 1;
+    print cuont;  // error: did you mean "count"?
+
+Declare the variable with "var" first, or fix the spelling:
+
+    print count;`,
+
+	E0402: `Assignment to undeclared variable
+
+Assignment only changes variables that already exist. Declare a variable with "var" before assigning to it.
+
+    total = 10;  // error
+
+Declare it instead:
+
+    var total = 10;`,
+
+	E0403: `Redeclared variable or function
+
+A name can only be declared once in the same scope. Assign to the existing variable instead, or declare the new one
+in a nested block.
+
+    var a = 1;
+    var a = 2;  // error
+
+Assign to it instead:
+
+    var a = 1;
+    a = 2;`,
+
+	E0404: `Calling a value that isn't a function
+
+Only functions can be called with "()".
+
+    var greeting = "hello";
+    greeting();  // error: "hello" is not callable`,
+
+	E0405: `Wrong number of arguments
+
+A function must be called with exactly as many arguments as it has parameters. arity(fn) gives the number a function
+expects.
+
+    fun add(a, b) { return a + b; }
+    add(1);        // error: too few arguments
+    add(1, 2, 3);  // error: too many arguments`,
+
+	E0406: `Operator applied to the wrong types
+
+Arithmetic operators need numbers or decimals. "+" can also join two strings, or a string and a number. Run golox
+with --stringify to let "+" join a string with any other value.
+
+    print "done: " + true;  // error without --stringify
+    print -"3";             // error
+
+Convert the value yourself, or use --stringify:
+
+    print "done: " + "true";`,
+
+	E0407: `Comparing mismatched types
+
+"<", "<=", ">" and ">=" compare numbers and decimals. Run golox with --loose to convert strings holding numbers when
+they are compared with numbers.
+
+    print "10" > 9;  // error without --loose`,
+
+	E0408: `Division by zero
+
+Dividing a number or decimal by zero has no meaningful result, so it is an error, as is taking the remainder with "%".
+The error gives the line of the division, so check the divisor before dividing.
+
+    print 1 / 0;             // error
+    print 7 % 0;             // error
+    print decimal("1") / 0;  // error`,
+
+	E0409: `Unknown property
+
+The value has no property or method with that name. Strings have length(), upper() and lower(), numbers have
+floor(), ceil(), round() and abs(), and arrays have length(), push(x) and pop(). The error suggests a similar name when
+there is one.
+
+    print "hello".lenght();  // error: did you mean "length"?`,
+
+	E0410: `Wrong type of argument to a native function
+
+A built-in function was passed a value of a type it doesn't accept, or a number it can't use.
+
+    print arity(3);      // error: arity() expects a function
+    print decimal(nil);  // error: decimal() expects a number or string
+    exit(300);           // error: exit statuses are whole numbers from 0 to 255`,
+
+	E0411: `argv() index out of range
+
+argv(i) returns the i-th argument passed to the script, counting from 0. Check argc() first.
+
+    // golox script.lox one two
+    print argv(2);  // error: only argv(0) and argv(1) exist`,
+
+	E0412: `Native function not implemented
+
+The built-in function is declared but has no implementation in this version of golox.`,
+
+	E0413: `Index out of range
+
+Arrays and strings are indexed from 0, so the last element of an array a is a[len(a) - 1]. Indexes must be whole
+numbers within the array or string. A slice a[start:end] may end at len(a), and its start can't be after its end.
+
+    var a = [1, 2, 3];
+    print a[3];    // error: a has elements 0 to 2
+    print a[1.5];  // error
+    print a[2:1];  // error
+
+Check the index against len() first, or add elements with push():
+
+    a.push(4);
+    print a[3];`,
+
+	E0414: `Indexing a value that can't be indexed
+
+Only arrays and strings can be indexed or sliced with "[]", and only arrays can have their elements assigned to:
+strings can't be changed once created.
+
+    var n = 10;
+    print n[0];     // error
+    var s = "cat";
+    s[0] = "b";     // error
+
+Build a new string instead:
+
+    s = "b" + s[1:];`,
+
+	E0415: `Iterating over a value that isn't a collection
+
+A for-in loop runs once for each element of an array, or each character of a string. Other values have no elements
+to loop over.
+
+    for (var x in 10) print x;  // error
+
+Loop over a range of numbers with a counting loop instead:
+
+    for (var x = 0; x < 10; x++) print x;`,
+
+	E0416: `Error from a host function
+
+A function provided by the program embedding golox, rather than built into Lox, failed. The message after the
+function's name is the host's description of what went wrong; see the embedding program's documentation for what the
+function expects.`,
+
+	E0417: `Stack overflow
+
+Too many function calls were in progress at once, usually because a recursive function never reaches the case that
+stops it. By default 10000 calls may be in progress; run golox with --max-stack to allow more.
+
+    fun countdown(n) {
+      print n;
+      countdown(n - 1);  // error: never stops
+    }
+
+Give the recursion a case where it stops:
+
+    fun countdown(n) {
+      if (n < 0) return;
+      print n;
+      countdown(n - 1);
+    }`,
+
+	E0418: `Internal error
+
+Something went wrong inside golox while it ran the program, such as a Go nil pointer dereference, rather than a
+mistake in the program itself. The program stops at the statement it had reached, as it would for any other runtime
+error. A native function or hook added by a program embedding golox can also cause it by panicking.
+
+Please report the script that causes it, along with the message after "internal error:", so it can be fixed.`,
+
+	E0419: `Failed assertion
+
+The condition passed to assert() was falsy, so the program stopped with the message passed along with it. An
+assertion states something the program expects always to be true, so a failure points to a bug at or before it.
+
+    fun average(values) {
+      assert(len(values) > 0, "average() needs at least one value");
+      ...
+    }
+
+Fix whatever made the condition false. Running golox with -ea=false turns assertions off, so assert() does nothing.`,
+
+	E0420: `Imported file can't be read or has errors
+
+The file named by an import statement doesn't exist, can't be read, or has a lexing, parsing or resolving error,
+which is shown after the message. Paths are relative to the directory of the file doing the importing, not the
+working directory. Files not found there are looked for in the directories given with --path and in LOX_PATH, then
+in the standard library bundled into golox, whose modules start with std/.
+
+    // in src/main.lox
+    import "src/lib/math.lox";  // error: looks for src/src/lib/math.lox
+
+Give the path from the importing file:
+
+    import "lib/math.lox";`,
+
+	E0421: `Import cycle
+
+A file imported itself, directly or through the files it imports, before it had finished running. Its globals
+wouldn't all be declared yet, so golox stops rather than giving the importing file a half-loaded module. The message
+lists the chain of imports.
+
+    // in a.lox
+    import "b.lox";
+
+    // in b.lox
+    import "a.lox";  // error: a.lox imports b.lox imports a.lox
+
+Move what both files need into a third file that they each import.`,
+}
+
+// warningExplanations describe each warning code, as explanations do for errors
+var warningExplanations = map[Code]string{
+	W0101: `Malformed number literal
+
+A number literal has a second decimal point. The lexer ends the number before it and skips it, so the rest of the
+literal is read as a new number, which usually leads to a parsing error as well.
+
+    var version = 1.2.3;  // warning: lexed as 1.2 then 3
+
+Use a string for values with several points:
+
+    var version = "1.2.3";`,
+
+	W0301: `Unused local variable
+
+A variable declared inside a block or function is never read. It may be left over from earlier code, or a
+misspelling may mean a different variable is read instead. Assigning to a variable doesn't count as using it.
+Function parameters and the variables of for-in loops aren't reported.
+
+    fun area(w, h) {
+      var size = w * h;  // warning: size is never used
+      return w * h;
+    }
+
+Remove the variable, or use it:
+
+    fun area(w, h) {
+      var size = w * h;
+      return size;
+    }`,
+
+	W0302: `Unreachable code
+
+Statements follow a return, break or continue in the same block, so they can never run.
+
+    fun sign(n) {
+      return n < 0 ? -1 : 1;
+      print "done";  // warning: never printed
+    }
+
+Remove the statements, or move them before the return.`,
+
+	W0303: `If branch that never runs
+
+The condition of an if statement is a literal, such as true, false or nil, so one of its branches can never run. It is
+reported when golox --optimize removes the branch.
+
+    if (false) {
+      print "debugging";  // warning: removed
+    }
+
+Remove the if statement, or make its condition depend on something, such as a variable.`,
+
+	W0401: `Unused global variable or function
+
+A variable or function declared at the top level of a script is never read, reported by golox lint. It may be left
+over from earlier code, or a misspelling may mean a different name is used instead. Assigning to a variable doesn't
+count as using it.
+
+    fun helper() { return 1; }  // warning: helper is never called
+    print 2;
+
+Remove the declaration, or use it.`,
+
+	W0402: `Shadowed variable
+
+A variable, function or parameter has the same name as one declared in an enclosing scope, which it hides, reported
+by golox lint. Code inside the inner scope can't reach the outer one, and it is easy to read the wrong one.
+
+    var count = 0;
+    fun add(n) {
+      var count = n;  // warning: hides the global count
+      count = count + 1;
+    }
+
+Rename one of them.`,
+
+	W0403: `Self-assignment
+
+A variable or array element is assigned its own value, which does nothing, reported by golox lint. Usually a
+different variable was meant on one side.
+
+    fun setName(name) {
+      name = name;  // warning
+    }`,
+
+	W0404: `Constant condition
+
+The condition of an if statement, while loop or "?:" expression is a literal, so it is always true or always false
+and one branch never runs, reported by golox lint. A while loop on the literal true, which runs until a break or
+return, isn't reported.
+
+    if (false) {  // warning
+      print "debugging";
+    }`,
+
+	W0405: `Empty block
+
+A block has no statements in it, reported by golox lint. It may be unfinished code. Empty function bodies aren't
+reported, and neither are blocks holding only a comment, which can explain why they are empty.
+
+    if (ready) {}  // warning`,
+
+	W0406: `Too many parameters
+
+A function takes more parameters than golox lint allows, 5 by default, which makes its calls hard to read. Group
+related values into an array, or split the function up.
+
+    fun draw(x, y, w, h, color, border) {}  // warning: 6 parameters`,
+}
+
+// Explain describes an error code at length, with examples. The code may be given in either case, eg "e0203"
+func Explain(code string) (string, bool) {
+	explanation, ok := explanations[Code(strings.ToUpper(code))]
+	if !ok {
+		explanation, ok = warningExplanations[Code(strings.ToUpper(code))]
+	}
+	return explanation, ok
+}
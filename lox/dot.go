@@ -0,0 +1,52 @@
+package lox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ToDOT converts an AST into a graph in Graphviz's DOT language, eg for golox ast --dot script.lox | dot -Tsvg. Each
+// node is a box showing its type, value and position, with edges to its children labelled Left, Right and Third.
+// Statements, arguments and other nodes following one another are joined by dashed Next edges
+func (n *Node) ToDOT() string {
+	d := &dotWriter{}
+	d.b.WriteString("digraph AST {\n")
+	d.b.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	d.node(n)
+	d.b.WriteString("}\n")
+	return d.b.String()
+}
+
+type dotWriter struct {
+	b    strings.Builder
+	next int // id of the next node written
+}
+
+// node writes n, the nodes inside it and those following it, returning n's id
+func (d *dotWriter) node(n *Node) int {
+	id := d.next
+	d.next++
+
+	label := n.Type.String()
+	if n.Data != nil {
+		label += " " + formatSExpressionValue(n.sExpressionValue())
+	}
+	if n.Line != 0 {
+		label += fmt.Sprintf("\n%d:%d", n.Line, n.Column)
+	}
+	fmt.Fprintf(&d.b, "  n%d [label=%s];\n", id, strconv.Quote(label))
+
+	for _, child := range []struct {
+		name string
+		node *Node
+	}{{"Left", n.Left}, {"Right", n.Right}, {"Third", n.Third}} {
+		if child.node != nil {
+			fmt.Fprintf(&d.b, "  n%d -> n%d [label=%q];\n", id, d.node(child.node), child.name)
+		}
+	}
+	if n.Next != nil {
+		fmt.Fprintf(&d.b, "  n%d -> n%d [label=\"Next\", style=dashed];\n", id, d.node(n.Next))
+	}
+	return id
+}
@@ -0,0 +1,162 @@
+package lox
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Interpreter runs Lox source for Go programs using golox as a library. Its global scope persists between calls, so
+// variables and functions declared by one call to Eval can be used by the next
+type Interpreter struct {
+	global *Environment
+}
+
+// New creates an Interpreter with an empty global scope, holding only the native functions
+func New(opts Options) *Interpreter {
+	return &Interpreter{global: NewEnvironment(opts)}
+}
+
+// NewSession creates an Interpreter for interactive use, like a REPL, where each line is run with Eval. Globals may be
+// declared again, replacing the earlier declaration, so a function can be fixed and entered again. Functions registered
+// with atExit() run when the program calls exit() or when Close is called, rather than after each Eval
+func NewSession(opts Options) *Interpreter {
+	in := New(opts)
+	in.global.interp.session = true
+	return in
+}
+
+// Close ends a session, running the functions registered with atExit(). It returns an ExitError if one of them calls
+// exit(), or the error that stopped one of them. For an Interpreter created with New, it does nothing
+func (in *Interpreter) Close() error {
+	if !in.global.interp.session {
+		return nil
+	}
+	err := in.global.runExitHooks(nil)
+	in.global.report(err)
+	return err
+}
+
+// Global is the scope programs run by the Interpreter declare their globals in, for setting arguments, interrupting a
+// program from another goroutine, or reading variables a program has set
+func (in *Interpreter) Global() *Environment {
+	return in.global
+}
+
+// SetStdout sends the output of print statements to w, instead of os.Stdout, eg to capture it in a buffer or send it
+// over a network connection
+func (in *Interpreter) SetStdout(w io.Writer) {
+	in.global.SetStdout(w)
+}
+
+// SetStderr sends the Interpreter's debugging output to w, instead of os.Stderr
+func (in *Interpreter) SetStderr(w io.Writer) {
+	in.global.SetStderr(w)
+}
+
+// SetLimits bounds the statements, call depth, and memory each program run by the Interpreter may use. Each call to
+// Eval starts counting its statements again
+func (in *Interpreter) SetLimits(limits Limits) {
+	in.global.SetLimits(limits)
+}
+
+// SetReporter sends diagnostics for every error found by Eval, EvalFile or Close to r, from lexing, parsing, and
+// resolving the program as well as running it, so they can be collected or formatted in one place. The errors are
+// still returned as usual
+func (in *Interpreter) SetReporter(r ErrorReporter) {
+	in.global.SetReporter(r)
+}
+
+// SetHooks registers functions to be called as programs run, before each statement and around each function call,
+// eg for a profiler or debugger
+func (in *Interpreter) SetHooks(hooks Hooks) {
+	in.global.SetHooks(hooks)
+}
+
+// RegisterNative defines a Go function that programs run by the Interpreter can call, as Environment.RegisterNative
+// does
+func (in *Interpreter) RegisterNative(name string, arity int, fn func(args []*Node) (*Node, error)) {
+	in.global.RegisterNative(name, arity, fn)
+}
+
+// Eval lexes, parses, resolves and runs src. When the last statement of src is an expression statement, its value is
+// returned, so Eval("1 + 2;") returns the number 3. Otherwise the result is nil. As with Interpret, functions
+// registered with atExit() run when src finishes, and a call to exit() is returned as an ExitError
+func (in *Interpreter) Eval(src string) (*Node, error) {
+	tokens, err := LexReporting(src, in.global.interp.reporter)
+	if err != nil {
+		in.global.report(err)
+		return nil, err
+	}
+	prgm, err := Parse(tokens)
+	if err != nil {
+		in.global.report(err)
+		return nil, err
+	}
+	return in.evalProgram(prgm)
+}
+
+// RunScript runs src in a new Interpreter with the default Options, returning what it printed, the diagnostics found
+// for it, warnings included, and the error that stopped it, if any. It lets Go tests, in golox or in programs
+// embedding it, check what a script does without running the golox command
+func RunScript(src string) (stdout string, diags []Diagnostic, err error) {
+	in := New(Options{})
+	var out strings.Builder
+	in.SetStdout(&out)
+	collected := &diagnosticList{}
+	in.SetReporter(collected)
+	_, err = in.Eval(src)
+	return out.String(), *collected, err
+}
+
+// diagnosticList is an ErrorReporter keeping every diagnostic reported to it
+type diagnosticList []Diagnostic
+
+func (l *diagnosticList) Report(diag Diagnostic) {
+	*l = append(*l, diag)
+}
+
+// EvalContext is like Eval, but stops the program with an InterruptError if ctx is cancelled or times out, so a server
+// running untrusted scripts can end one stuck in a loop. Cancellation is checked before each statement
+func (in *Interpreter) EvalContext(ctx context.Context, src string) (*Node, error) {
+	defer in.global.watchContext(ctx)()
+	return in.Eval(src)
+}
+
+// EvalFile runs the script at path as Eval does, with its imports found relative to it. Files ending in .sexpr hold an AST written by ToSExpression, and are
+// read with FromSExpression instead of being lexed and parsed, as are scripts written by Compile, whatever their name
+func (in *Interpreter) EvalFile(path string) (*Node, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err // not a problem in the program, so it isn't reported
+	}
+	in.global.SetScriptPath(path)
+	if IsCompiled(src) {
+		prgm, err := LoadCompiled(src)
+		if err != nil {
+			in.global.report(err)
+			return nil, err
+		}
+		return in.evalProgram(prgm)
+	}
+	if !strings.HasSuffix(path, ".sexpr") {
+		return in.Eval(string(src))
+	}
+	prgm, err := FromSExpression(string(src))
+	if err != nil {
+		in.global.report(err)
+		return nil, err
+	}
+	return in.evalProgram(prgm)
+}
+
+func (in *Interpreter) evalProgram(prgm *Node) (*Node, error) {
+	if err := ResolveReporting(prgm, in.global.interp.reporter); err != nil {
+		in.global.report(err)
+		return nil, err
+	}
+	result, err := prgm.evaluate(in.global)
+	in.global.report(err)
+	return result, err
+}
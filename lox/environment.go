@@ -1,15 +1,218 @@
 package lox
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
 
 // Environment holds the values of identifiers for a particular scope
 type Environment struct {
 	Enclosing *Environment
-	Values    map[string]*Node
+	// Values holds globals, and the local variables of programs that weren't resolved. It is nil in local scopes
+	// until something is stored in it. Use Lookup to find any variable
+	Values map[string]*Node
+	// the local variables Resolve gave slots to, which are found by index rather than by hashing their names, and
+	// the name of the variable in each slot
+	slots []*Node
+	names []string
+	// the global scope env is nested in: the program's, or that of the module whose code created env
+	global *Environment
+	// for global scopes, the file the program or module was read from, which its imports are found relative to
+	path   string
+	interp *interpreter
 }
 
-func (env *Environment) printScope() {
-	fmt.Print("\n")
+// NewEnvironment creates a global scope, with native functions defined, for running programs with the given options
+func NewEnvironment(opts Options) *Environment {
+	global := &Environment{
+		Values: make(map[string]*Node),
+		interp: &interpreter{options: opts, started: time.Now(), stdout: os.Stdout, stderr: os.Stderr},
+	}
+	global.global = global
+	global.interp.globals = global
+	global.setNativeFunctions()
+	return global
+}
+
+// SetStdout sends the output of print statements run in env to w, instead of os.Stdout
+func (env *Environment) SetStdout(w io.Writer) {
+	env.interp.stdout = w
+}
+
+// SetStderr sends debugging output from env to w, instead of os.Stderr
+func (env *Environment) SetStderr(w io.Writer) {
+	env.interp.stderr = w
+}
+
+// SetLimits bounds the statements, call depth, and memory programs run in env may use
+func (env *Environment) SetLimits(limits Limits) {
+	env.interp.limits = limits
+}
+
+// SetArgs makes args available to the program through the argc() and argv(i) natives, and as an array of strings in
+// the global variable args
+func (env *Environment) SetArgs(args []string) {
+	env.interp.args = args
+	arr := &ArrayValue{Elements: make([]*Node, len(args))}
+	for i, arg := range args {
+		arr.Elements[i] = &Node{Type: StringNT, Data: StringValue(arg)}
+	}
+	env.Values["args"] = &Node{Type: ArrayNT, Data: arr}
+}
+
+// Interrupt stops the program running in env before its next statement, making Interpret return an InterruptError. It is safe to call from another goroutine, eg when handling SIGINT
+func (env *Environment) Interrupt() {
+	env.interruptWith(nil)
+}
+
+func (env *Environment) interruptWith(cause error) {
+	env.interp.interruptCause = cause
+	atomic.StoreInt32(&env.interp.interrupted, 1)
+}
+
+// globalDepth is the depth Resolve gives variables that aren't declared in any local scope
+const globalDepth = -1
+
+// ancestor is the scope depth scopes out from env, or the global scope for globalDepth
+func (env *Environment) ancestor(depth int) *Environment {
+	if depth == globalDepth {
+		return env.global
+	}
+	for i := 0; i < depth; i++ {
+		env = env.Enclosing
+	}
+	return env
+}
+
+// get finds the value of the variable ident names, or reports false if it hasn't been declared. Local variables bound
+// by Resolve are read straight from their slots, globals from the global scope, and others by searching each enclosing
+// scope in turn
+func (env *Environment) get(ident *Node) (*Node, bool) {
+	if ident.resolved {
+		scope := env.ancestor(ident.depth)
+		if ident.depth != globalDepth {
+			val := scope.slots[ident.slot]
+			return val, val != nil
+		}
+		val, ok := scope.Values[ident.ToString()]
+		return val, ok
+	}
+	return env.Lookup(ident.ToString())
+}
+
+// set stores a new value in the variable ident names, reporting false if it hasn't been declared
+func (env *Environment) set(ident *Node, val *Node) bool {
+	if ident.resolved && ident.depth != globalDepth {
+		scope := env.ancestor(ident.depth)
+		if scope.slots[ident.slot] == nil {
+			return false
+		}
+		scope.slots[ident.slot] = val
+		return true
+	}
+	name := ident.ToString()
+	scope := env.global
+	if !ident.resolved {
+		for scope = env; scope != nil; scope = scope.Enclosing {
+			if _, ok := scope.Values[name]; ok {
+				break
+			}
+		}
+	}
+	if scope == nil {
+		return false
+	}
+	if _, ok := scope.Values[name]; !ok {
+		return false
+	}
+	scope.Values[name] = val
+	return true
+}
+
+// define stores the value of a variable declared in env, in the slot Resolve gave it if it has one. ident is the name
+// in the declaration
+func (env *Environment) define(ident *Node, val *Node) {
+	if ident.resolved && ident.depth != globalDepth {
+		env.slots[ident.slot] = val
+		return
+	}
+	if env.Values == nil {
+		env.Values = make(map[string]*Node)
+	}
+	env.Values[ident.ToString()] = val
+}
+
+// defined reports whether the variable declared by ident is already defined in env, rather than an enclosing scope
+func (env *Environment) defined(ident *Node) bool {
+	if ident.resolved && ident.depth != globalDepth {
+		return env.slots[ident.slot] != nil
+	}
+	_, ok := env.Values[ident.ToString()]
+	return ok
+}
+
+// Lookup finds the value of the variable called name in env or the scopes enclosing it, eg for a debugger. It reports
+// false if there is no such variable
+func (env *Environment) Lookup(name string) (*Node, bool) {
+	for scope := env; scope != nil; scope = scope.Enclosing {
+		if val, ok := scope.Values[name]; ok {
+			return val, true
+		}
+		for i, local := range scope.names {
+			if local == name && scope.slots[i] != nil {
+				return scope.slots[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// each calls fn with the name and value of each variable defined in env, but not the scopes enclosing it
+func (env *Environment) each(fn func(name string, val *Node)) {
+	for name, val := range env.Values {
+		fn(name, val)
+	}
+	for i, name := range env.names {
+		if env.slots[i] != nil {
+			fn(name, env.slots[i])
+		}
+	}
+}
+
+// newScope creates a scope nested inside env, with a slot for each of the names Resolve found declared in it, from
+// the locals of the node creating the scope
+func (env *Environment) newScope(names []string) *Environment {
+	if env.interp.memProfile != nil {
+		env.interp.memProfile.openScope()
+	}
+	scope := &Environment{
+		Enclosing: env,
+		names:     names,
+		global:    env.global,
+		interp:    env.interp,
+	}
+	if len(names) > 0 {
+		scope.slots = make([]*Node, len(names))
+	}
+	return scope
+}
+
+// closeScope is called when the block or function call that created a scope finishes
+func (env *Environment) closeScope() {
+	if env.interp.memProfile != nil {
+		env.interp.memProfile.liveScopes--
+	}
+}
+
+// PrintScope writes the names and values in env and each scope enclosing it, from the global scope inwards, to the
+// writer set with SetStderr
+func (env *Environment) PrintScope() {
+	w := env.interp.stderr
+	fmt.Fprint(w, "\n")
 	scopes := []*Environment{}
 	scope := env
 	for scope != nil {
@@ -18,9 +221,23 @@ func (env *Environment) printScope() {
 	}
 
 	for depth := 0; depth < len(scopes); depth++ {
-		fmt.Printf("Scope %d:\n", depth)
-		for k, v := range scopes[depth].Values {
-			fmt.Printf("\t%s: %s\n", k, v.ToString())
+		fmt.Fprintf(w, "Scope %d:\n", depth)
+		values := map[string]*Node{}
+		scopes[depth].each(func(name string, val *Node) {
+			values[name] = val
+		})
+		names := []string{}
+		for k := range values {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Fprintf(w, "\t%s: %s\n", k, values[k].ToString())
 		}
 	}
 }
+
+// CallStack names the functions being called in env's program, innermost first, as in a runtime error's stack trace
+func (env *Environment) CallStack() []string {
+	return env.interp.stackTrace()
+}
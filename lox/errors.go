@@ -0,0 +1,234 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// RuntimeError is returned by Interpret when a Lox program fails while running. Line and Column are where the expression or statement that failed is, or 0 if the AST doesn't record it. File is the imported file they are in, or "" if the error is in the program itself. Stack names the functions that were being called, innermost first
+type RuntimeError struct {
+	Code    Code
+	Line    int
+	Column  int
+	File    string
+	Message string
+	Stack   []string
+}
+
+func (e *RuntimeError) Error() string {
+	position := formatPosition(e.Line, e.Column)
+	if e.File != "" {
+		position += " of " + e.File
+	}
+	return "Runtime error [" + string(e.Code) + "]" + position + ": " + e.Message + formatStack(e.Stack)
+}
+
+// LexError is returned by Lex when the source contains a character that can't start a token. Lexeme is that character
+type LexError struct {
+	Code    Code
+	Line    int
+	Column  int
+	Lexeme  string
+	Message string
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("Lexing error [%s] on line %d, column %d: %s", e.Code, e.Line, e.Column, e.Message)
+}
+
+// ParseError is returned by Parse when the tokens don't form a valid program. Line, Column and Lexeme describe the token where the parser found the error
+type ParseError struct {
+	Code    Code
+	Line    int
+	Column  int
+	Lexeme  string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Parsing error [%s] on line %d, column %d: %s", e.Code, e.Line, e.Column, e.Message)
+}
+
+// ParseErrors is returned by Parse, listing every error in a program in the order they were found
+type ParseErrors []error
+
+func (errs ParseErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ResolveError is returned by Resolve. Line, Column and Lexeme describe the node where the error is, such as a duplicate parameter or a misplaced return statement's keyword. Line and Column are 0 if the AST doesn't record them, in which case Line is where the statement containing the error starts, if that is known
+type ResolveError struct {
+	Code    Code
+	Line    int
+	Column  int
+	Lexeme  string
+	Message string
+}
+
+func (e *ResolveError) Error() string {
+	return "Resolving error [" + string(e.Code) + "]" + formatPosition(e.Line, e.Column) + ": " + e.Message
+}
+
+// InterruptError is returned by Interpret when the program is stopped by Environment.Interrupt, or by its context finishing. Cause is the context's error, if any
+type InterruptError struct {
+	Cause error
+	Stack []string
+}
+
+func (e *InterruptError) Error() string {
+	if e.Cause != nil {
+		return "Interrupted: " + e.Cause.Error() + formatStack(e.Stack)
+	}
+	return "Interrupted" + formatStack(e.Stack)
+}
+
+// LimitExceededError is returned by Interpret when a program goes over one of the Limits set with SetLimits. Limit
+// names the field of Limits that was exceeded, eg "MaxStatements"
+type LimitExceededError struct {
+	Limit   string
+	Message string
+	Stack   []string
+}
+
+func (e *LimitExceededError) Error() string {
+	return "Limit exceeded: " + e.Message + formatStack(e.Stack)
+}
+
+// Warning describes something in a program that is likely to be a mistake, but doesn't stop it running, such as a
+// local variable that is never used. Warnings are sent to an ErrorReporter rather than returned
+type Warning struct {
+	Code    Code
+	Line    int
+	Column  int
+	Message string
+}
+
+func (w *Warning) Error() string {
+	return "Warning [" + string(w.Code) + "]" + formatPosition(w.Line, w.Column) + ": " + w.Message
+}
+
+// ExitError is returned by Interpret when a program calls exit(code). Code is the exit status the program asked for
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// runtimeErrorf creates a RuntimeError to be panicked with, unwinding the interpreter back to Interpret
+func runtimeErrorf(code Code, format string, a ...interface{}) *RuntimeError {
+	return &RuntimeError{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// parseErrorf creates a ParseError at tok, the token where the parser found the error
+func parseErrorf(code Code, tok Token, format string, a ...interface{}) *ParseError {
+	return &ParseError{Code: code, Line: tok.Line, Column: tok.Column, Lexeme: tok.Lexeme, Message: fmt.Sprintf(format, a...)}
+}
+
+func formatLine(line int) string {
+	if line == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" on line %d", line)
+}
+
+func formatPosition(line int, column int) string {
+	if column == 0 {
+		return formatLine(line)
+	}
+	return fmt.Sprintf(" on line %d, column %d", line, column)
+}
+
+// formatStack lists the functions being called, one per line. Runs of the same function, as in deep recursion, are
+// written once with how many times it repeats
+func formatStack(stack []string) string {
+	var s strings.Builder
+	for i := 0; i < len(stack); {
+		j := i + 1
+		for j < len(stack) && stack[j] == stack[i] {
+			j++
+		}
+		s.WriteString("\n\tin " + stack[i])
+		if j-i > 1 {
+			fmt.Fprintf(&s, " (%d times)", j-i)
+		}
+		i = j
+	}
+	return s.String()
+}
+
+// FormatError describes err as its Error method does, followed by the line of src it was found on, with a caret marking
+// where, eg
+//
+//	Parsing error [E0203] on line 2, column 7: Expected semicolon after token "x"
+//	    2 | print x y;
+//	      |       ^
+//
+// Errors in ParseErrors are each followed by their own line. Errors without a position, or from other source or a
+// compiled script, are described as they are
+func FormatError(err error, src string) string {
+	if errs, ok := err.(ParseErrors); ok {
+		parts := make([]string, len(errs))
+		for i, e := range errs {
+			parts[i] = FormatError(e, src)
+		}
+		return strings.Join(parts, "\n")
+	}
+
+	var line, column, width int
+	switch e := err.(type) {
+	case *LexError:
+		line, column, width = e.Line, e.Column, utf8.RuneCountInString(e.Lexeme)
+	case *ParseError:
+		line, column, width = e.Line, e.Column, utf8.RuneCountInString(e.Lexeme)
+	case *RuntimeError:
+		if e.File != "" {
+			return err.Error() // not from this source
+		}
+		line, column = e.Line, e.Column
+	case *ResolveError:
+		line, column, width = e.Line, e.Column, utf8.RuneCountInString(e.Lexeme)
+	case *Warning:
+		line, column = e.Line, e.Column
+	}
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) || IsCompiled([]byte(src)) {
+		return err.Error()
+	}
+	text := []rune(strings.TrimRight(lines[line-1], "\r"))
+	if column > len(text)+1 {
+		return err.Error() // not from this source
+	}
+
+	gutter := fmt.Sprintf("%5d | ", line)
+	excerpt := gutter + string(text)
+	if column > 0 {
+		// the caret lines up under the error, keeping any tabs before it so they take up the same space
+		marker := []rune{}
+		for _, r := range text[:column-1] {
+			if r == '\t' {
+				marker = append(marker, '\t')
+			} else {
+				marker = append(marker, ' ')
+			}
+		}
+		marker = append(marker, '^')
+		for i := 1; i < width && column-1+i < len(text); i++ {
+			marker = append(marker, '~')
+		}
+		excerpt += "\n" + strings.Repeat(" ", len(gutter)-2) + "| " + string(marker)
+	}
+
+	// the excerpt goes straight after the message, before any stack trace
+	msg := err.Error()
+	if i := strings.Index(msg, "\n"); i >= 0 {
+		return msg[:i] + "\n" + excerpt + msg[i:]
+	}
+	return msg + "\n" + excerpt
+}
@@ -0,0 +1,376 @@
+package lox
+
+import "strings"
+
+// Format returns source rewritten in the canonical Lox style: two spaces of indentation, one statement per line, single
+// spaces around binary operators, and opening braces on the line of the statement they belong to. Comments are kept, as
+// are single blank lines between statements. The syntax the parser desugars, such as for loops and "+=", is
+// written as it was. It returns an error if source doesn't lex or parse
+func Format(source string) (string, error) {
+	tokens, err := Lex(source)
+	if err != nil {
+		return "", err
+	}
+	prgm, err := Parse(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	f := &formatter{lines: strings.Split(source, "\n")}
+	for stmt := prgm.Right; stmt != nil; stmt = stmt.Next {
+		f.stmt(stmt)
+	}
+	if prgm.Trivia != nil {
+		for _, c := range prgm.Trivia.Closing {
+			f.comment(c)
+		}
+	}
+	return f.out.String(), nil
+}
+
+type formatter struct {
+	out    strings.Builder
+	indent int
+	open   bool // whether the last line written is unfinished
+	// whether anything has been written in the current block, as blank lines at the start of one aren't kept
+	started bool
+
+	lines []string // of the source, to find blank lines
+}
+
+func (f *formatter) write(s string) {
+	f.out.WriteString(s)
+}
+
+// indentLine starts a line at the current indentation
+func (f *formatter) indentLine() {
+	f.write(strings.Repeat("  ", f.indent))
+	f.open = true
+}
+
+func (f *formatter) newline() {
+	f.write("\n")
+	f.open = false
+}
+
+// blankLineBefore writes a blank line if there is one before line in the source
+func (f *formatter) blankLineBefore(line int) {
+	if f.started && line >= 2 && line-2 < len(f.lines) && strings.TrimSpace(f.lines[line-2]) == "" {
+		f.newline()
+	}
+}
+
+// comment writes a comment on a line of its own
+func (f *formatter) comment(c Comment) {
+	f.blankLineBefore(c.Line)
+	f.indentLine()
+	f.write(c.Text)
+	f.newline()
+	f.started = true
+}
+
+// endLine finishes the line a statement ends on, adding the comments that were inside it or followed it
+func (f *formatter) endLine(n *Node) {
+	if n.Trivia != nil {
+		for _, c := range n.Trivia.Trailing {
+			if f.open {
+				f.write(" ")
+			} else {
+				f.indentLine()
+			}
+			f.write(c.Text)
+		}
+	}
+	if f.open {
+		f.newline()
+	}
+}
+
+// stmt writes a statement on lines of its own, after the comments before it
+func (f *formatter) stmt(n *Node) {
+	if n.Trivia != nil {
+		for _, c := range n.Trivia.Leading {
+			f.comment(c)
+		}
+	}
+	f.blankLineBefore(n.Line)
+	f.indentLine()
+	f.started = true
+	f.clause(n)
+}
+
+// clause writes a statement from where the line has got to, ending the line once it is done
+func (f *formatter) clause(n *Node) {
+	switch n.Type {
+	case VarDeclNT:
+		f.write("var " + n.Left.Data.String())
+		if n.Right != nil {
+			f.write(" = ")
+			f.expr(n.Right)
+		}
+		f.write(";")
+	case FunDeclNT:
+		f.write("fun " + n.Left.Data.String())
+		f.function(n)
+	case ImportStmtNT:
+		f.write("import ")
+		f.expr(n.Right)
+		if name := n.Left.Data.String(); name != ModuleName(n.Right.Data.String()) {
+			f.write(" as " + name)
+		}
+		f.write(";")
+	case PrintStmtNT:
+		f.write("print ")
+		f.expr(n.Right)
+		f.write(";")
+	case ReturnStmtNT:
+		f.write("return")
+		if n.Right != nil {
+			f.write(" ")
+			f.expr(n.Right)
+		}
+		f.write(";")
+	case BreakStmtNT:
+		f.write("break;")
+	case ContinueStmtNT:
+		f.write("continue;")
+	case ExprStmtNT:
+		f.expr(n.Right)
+		f.write(";")
+	case BlockNT:
+		if isDesugaredFor(n) {
+			f.forStmt(n)
+		} else {
+			f.block(n)
+		}
+	case IfStmtNT:
+		f.write("if (")
+		f.expr(n.Left)
+		f.write(")")
+		f.body(n.Right, n.Third != nil)
+		if n.Third == nil {
+			break
+		}
+		if f.open {
+			f.write(" else") // after the "}" of a block
+		} else {
+			f.indentLine()
+			f.write("else")
+		}
+		if n.Third.Type == IfStmtNT {
+			f.write(" ")
+			f.clause(n.Third)
+		} else {
+			f.body(n.Third, false)
+		}
+	case WhileStmtNT:
+		f.write("while (")
+		f.expr(n.Left)
+		f.write(")")
+		f.body(n.Right, false)
+	case ForInStmtNT:
+		f.write("for (var " + n.Left.Data.String() + " in ")
+		f.expr(n.Right)
+		f.write(")")
+		f.body(n.Third, false)
+	}
+	f.endLine(n)
+}
+
+// isBlock reports whether n is a block written with braces, rather than one the parser made from a for loop
+func isBlock(n *Node) bool {
+	return n.Type == BlockNT && !isDesugaredFor(n)
+}
+
+// isDesugaredFor reports whether n is a for loop the parser turned into a block holding the initializer, if any, and a
+// while loop, both placed at the "for"
+func isDesugaredFor(n *Node) bool {
+	if n.Type != BlockNT || n.Line == 0 || n.Right == nil {
+		return false
+	}
+	while := n.Right
+	if while.Next != nil {
+		while = while.Next
+	}
+	return while.Next == nil && while.Type == WhileStmtNT && samePosition(while, n)
+}
+
+func samePosition(a, b *Node) bool {
+	return a.Line != 0 && a.Line == b.Line && a.Column == b.Column
+}
+
+func (f *formatter) forStmt(n *Node) {
+	init, while := n.Right, n.Right
+	if init.Next != nil {
+		while = init.Next
+	} else {
+		init = nil
+	}
+	f.write("for (")
+	if init != nil && init.Type == VarDeclNT {
+		f.write("var " + init.Left.Data.String())
+		if init.Right != nil {
+			f.write(" = ")
+			f.expr(init.Right)
+		}
+	} else if init != nil {
+		f.expr(init.Right)
+	}
+	f.write("; ")
+	f.expr(while.Left)
+	f.write("; ")
+	f.expr(while.Third.Right)
+	f.write(")")
+	f.body(while.Right, false)
+}
+
+// body writes the statement run by an if, else or loop, on the same line if it is a block or a single statement. more
+// is whether an else follows, which goes after the "}" of a block unless comments follow the block
+func (f *formatter) body(n *Node, more bool) {
+	f.write(" ")
+	if !isBlock(n) {
+		f.clause(n)
+		return
+	}
+	f.block(n)
+	if !more || n.Trivia != nil && len(n.Trivia.Trailing) > 0 {
+		f.endLine(n)
+	}
+}
+
+// block writes a block's statements inside braces, leaving the line with the "}" unfinished
+func (f *formatter) block(n *Node) {
+	var closing []Comment
+	if n.Trivia != nil {
+		closing = n.Trivia.Closing
+	}
+	if n.Right == nil && len(closing) == 0 {
+		f.write("{}")
+		return
+	}
+	f.write("{")
+	f.newline()
+	f.indent++
+	f.started = false
+	for stmt := n.Right; stmt != nil; stmt = stmt.Next {
+		f.stmt(stmt)
+	}
+	for _, c := range closing {
+		f.comment(c)
+	}
+	f.indent--
+	f.indentLine()
+	f.write("}")
+}
+
+// function writes a function's parameters and body, for a declaration or an anonymous function
+func (f *formatter) function(n *Node) {
+	f.write("(")
+	for param := n.Right; param != nil; param = param.Next {
+		f.write(param.Data.String())
+		if param.Next != nil {
+			f.write(", ")
+		}
+	}
+	f.write(") ")
+	f.block(n.Third)
+}
+
+// expr writes an expression as it would appear in the source, with the parentheses it was written with
+func (f *formatter) expr(n *Node) {
+	switch n.Type {
+	case IdentifierNT, NumberNT:
+		f.write(n.Data.String())
+	case StringNT:
+		f.write("\"" + n.Data.String() + "\"")
+	case BoolNT:
+		f.write(n.Data.String())
+	case NilNT:
+		f.write("nil")
+	case GroupNT:
+		f.write("(")
+		f.expr(n.Right)
+		f.write(")")
+	case ArrayLiteralNT:
+		f.write("[")
+		f.list(n.Right)
+		f.write("]")
+	case CallNT:
+		f.expr(n.Left)
+		f.write("(")
+		f.list(n.Right)
+		f.write(")")
+	case GetNT:
+		f.expr(n.Left)
+		f.write("." + n.Right.Data.String())
+	case IndexNT:
+		f.expr(n.Left)
+		f.write("[")
+		f.expr(n.Right)
+		f.write("]")
+	case SliceNT:
+		f.expr(n.Left)
+		f.write("[")
+		if n.Right != nil {
+			f.expr(n.Right)
+		}
+		f.write(":")
+		if n.Third != nil {
+			f.expr(n.Third)
+		}
+		f.write("]")
+	case UnaryNT:
+		f.write(n.Data.String())
+		if n.Data.String() == "-" && (n.Right.Type == UnaryNT || n.Right.Type == IncrementNT && n.Right.Right != nil) && n.Right.Data.String()[0] == '-' {
+			f.write(" ") // so the minus signs aren't read as "--"
+		}
+		f.expr(n.Right)
+	case ConditionalNT:
+		f.expr(n.Left)
+		f.write(" ? ")
+		f.expr(n.Right)
+		f.write(" : ")
+		f.expr(n.Third)
+	case LambdaNT:
+		f.write("fun ")
+		f.function(n)
+	case IncrementNT:
+		if n.Right != nil {
+			f.write(n.Data.String())
+			f.expr(n.Right)
+		} else {
+			f.expr(n.Left)
+			f.write(n.Data.String())
+		}
+	case AssignmentNT:
+		f.expr(n.Left)
+		switch {
+		case n.Third != nil:
+			// a[i] += b
+			f.write(" " + n.Third.Data.String() + "= ")
+			f.expr(n.Right)
+		case (n.Right.Type == TermNT || n.Right.Type == FactorNT) && samePosition(n.Right, n) && samePosition(n.Right.Left, n):
+			// a += b, parsed as a = a + b
+			f.write(" " + n.Right.Data.String() + "= ")
+			f.expr(n.Right.Right)
+		default:
+			f.write(" = ")
+			f.expr(n.Right)
+		}
+	default:
+		// binary operators
+		f.expr(n.Left)
+		f.write(" " + n.Data.String() + " ")
+		f.expr(n.Right)
+	}
+}
+
+// list writes expressions connected by Next, separated by commas
+func (f *formatter) list(n *Node) {
+	for ; n != nil; n = n.Next {
+		f.expr(n)
+		if n.Next != nil {
+			f.write(", ")
+		}
+	}
+}
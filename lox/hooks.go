@@ -0,0 +1,21 @@
+package lox
+
+// Hooks are functions called as a program runs, so programs embedding golox can build profilers, coverage tools, and
+// debuggers without changing the interpreter. Any of them may be nil. They are called on the goroutine running the
+// program, which waits for them to return
+type Hooks struct {
+	// OnStatement is called before each statement runs, with the scope it runs in. Statements nested in blocks, loops
+	// and function bodies are each passed in as they run
+	OnStatement func(stmt *Node, env *Environment)
+	// OnCall is called when a function, including a native one, is called, with its name and the evaluated arguments
+	OnCall func(name string, args []*Node)
+	// OnReturn is called when a function call finishes, with the function's name and the value it returned. A call
+	// stopped by a runtime error doesn't return
+	OnReturn func(name string, value *Node)
+}
+
+// SetHooks registers functions to be called as programs run in env, replacing any registered before. Pass Hooks{} to
+// remove them
+func (env *Environment) SetHooks(hooks Hooks) {
+	env.interp.hooks = hooks
+}
@@ -1,69 +1,237 @@
 package lox
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
 
-// Interpret is the main function called on a Lox program
-func (prgm *Node) Interpret() {
+// Interpret is the main function called on a Lox program. Global declarations are stored in global, which can be created with NewEnvironment
+// When the program finishes or calls exit(), functions registered with atExit() are run before returning. Errors are
+// also sent to global's ErrorReporter, if it has one
+func (prgm *Node) Interpret(global *Environment) error {
+	_, err := prgm.evaluate(global)
+	global.report(err)
+	return err
+}
+
+// evaluate runs prgm as Interpret does, and returns the value of its last statement if that is an expression
+// statement, or nil otherwise
+func (prgm *Node) evaluate(global *Environment) (*Node, error) {
 	if prgm.Type != ProgramNT {
-		fmt.Printf("\nRuntime error: ...")
-		return
+		return nil, runtimeErrorf(E0400, "\"%s\" is not a program", prgm.ToString())
 	}
-	global := &Environment{Values: make(map[string]*Node)}
-	global.setNativeFunctions()
-	stmt := prgm.Right
 
-	// fmt.Println("Program S-expression:")
-	// fmt.Println(stmt.ToSExpression(), "\n\n")
+	global.interp.startLimits()
+	var result *Node
+	err := global.run(func() {
+		for stmt := prgm.Right; stmt != nil; stmt = stmt.Next {
+			if stmt.Next == nil && stmt.Type == ExprStmtNT {
+				// run as a return statement, which passes the expression's value back out
+				result = global.interpretStmt(&Node{Type: ReturnStmtNT, Right: stmt.Right, Line: stmt.Line, Column: stmt.Column})
+			} else if global.interpretStmt(stmt) != nil {
+				// a return, break or continue outside any function or loop, in a program that wasn't resolved
+				return
+			}
+		}
+	})
+	if _, exited := err.(*ExitError); err != nil && !exited {
+		return nil, err
+	}
+	if global.interp.session && err == nil {
+		// exit hooks wait for the session to end
+		return result, nil
+	}
+	return result, global.runExitHooks(err)
+}
+
+// InterpretContext is like Interpret, but stops the program with an InterruptError if ctx is cancelled or times out.
+// Cancellation is checked before each statement, including each iteration of a loop, and ends calls to sleep() early
+func (prgm *Node) InterpretContext(ctx context.Context, global *Environment) error {
+	defer global.watchContext(ctx)()
+	return prgm.Interpret(global)
+}
 
-	for stmt != nil {
-		stmt = global.interpretStmt(stmt)
+// watchContext interrupts the program running in global when ctx finishes. The returned function stops watching, and
+// must be called once the program is done, so a context finishing just after it can't interrupt the next program
+func (global *Environment) watchContext(ctx context.Context) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			global.interruptWith(ctx.Err())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		atomic.StoreInt32(&global.interp.interrupted, 0)
 	}
+}
+
+// run calls f, recovering from runtime errors and calls to exit() and returning them as errors. Any other panic is
+// returned as an internal error, E0418
+func (env *Environment) run(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *RuntimeError:
+				e.Line, e.Column = env.interp.line, env.interp.column
+				e.File = env.interp.currentFile()
+				e.Stack = env.interp.stackTrace()
+				err = e
+			case *InterruptError:
+				e.Stack = env.interp.stackTrace()
+				err = e
+			case *LimitExceededError:
+				e.Stack = env.interp.stackTrace()
+				err = e
+			case *ExitError:
+				err = e
+			default:
+				// a bug in golox, or in a native or hook added by the program embedding it, such as a nil pointer
+				// dereference. It stops the Lox program with a runtime error where it had got to, rather than crashing
+				// the embedding program along with it
+				err = &RuntimeError{
+					Code:    E0418,
+					Line:    env.interp.line,
+					Column:  env.interp.column,
+					Message: fmt.Sprintf("internal error: %v", r),
+					Stack:   env.interp.stackTrace(),
+				}
+			}
+			env.interp.frames = nil
+			env.interp.abandonImports()
+		}
+	}()
+	f()
+	return nil
+}
+
+// runExitHooks calls the functions registered with atExit(), most recent first. A hook calling exit() changes the exit code, and a runtime error in a hook stops the rest from running
+func (env *Environment) runExitHooks(err error) error {
+	for len(env.interp.atExit) > 0 {
+		last := len(env.interp.atExit) - 1
+		hook := env.interp.atExit[last]
+		env.interp.atExit = env.interp.atExit[:last]
+		hookErr := env.run(func() {
+			env.call(hook, []*Node{})
+		})
+		if hookErr != nil {
+			err = hookErr
+			if _, exited := hookErr.(*ExitError); !exited {
+				return err
+			}
+		}
+	}
+	return err
+}
 
+// interpretStmts runs a list of statements connected by Next, stopping early if one of them returns. It returns the
+// value of the return statement that ran, or nil if none did
+func (env *Environment) interpretStmts(stmt *Node) *Node {
+	for ; stmt != nil; stmt = stmt.Next {
+		if result := env.interpretStmt(stmt); result != nil {
+			return result
+		}
+	}
+	return nil
 }
 
-// interpretStmt dispatches statement nodes to functions that handle particular types of statements
+// interpretStmt dispatches statement nodes to functions that handle particular types of statements. Only the statement
+// itself is run, and not the ones following it. It returns the value of a return statement that ran, or a break or
+// continue statement that ran, which is passed back up to its loop. It returns nil if none of them ran
 func (env *Environment) interpretStmt(stmt *Node) *Node {
-	var next *Node
+	if atomic.CompareAndSwapInt32(&env.interp.interrupted, 1, 0) {
+		panic(&InterruptError{Cause: env.interp.interruptCause})
+	}
+	if env.interp.budget != nil {
+		env.interp.budget.take()
+	}
+	if env.interp.limits != (Limits{}) {
+		env.interp.checkLimits()
+	}
+	if stmt.Line != 0 {
+		env.interp.line, env.interp.column = stmt.Line, stmt.Column
+	}
+	if on := env.interp.hooks.OnStatement; on != nil && stmt.Type != DeclarationNT && stmt.Type != StmtNT {
+		on(stmt, env)
+	}
+	if env.interp.trace != nil {
+		return env.traceStmt(stmt)
+	}
+	return env.execStmt(stmt)
+}
+
+// execStmt runs a statement, once interpretStmt has checked it may
+func (env *Environment) execStmt(stmt *Node) *Node {
 	switch stmt.Type {
-	case DeclarationNT, StmtNT, ExprStmtNT:
-		_ = env.interpretStmt(stmt.Right)
-		next = stmt.Next
+	case DeclarationNT, StmtNT:
+		return env.interpretStmt(stmt.Right)
+	case ExprStmtNT:
+		env.interpretExpr(stmt.Right)
 	case VarDeclNT:
-		next = env.interpretVarDecl(stmt)
+		env.interpretVarDecl(stmt)
 	case FunDeclNT:
-		next = env.interpretFunDecl(stmt)
+		env.interpretFunDecl(stmt)
 	case BlockNT:
-		next = env.interpretBlock(stmt)
+		return env.interpretBlock(stmt)
 	case IfStmtNT:
-		next = env.interpretIfStmt(stmt)
+		return env.interpretIfStmt(stmt)
 	case WhileStmtNT:
-		next = env.interpretWhileStmt(stmt)
+		return env.interpretWhileStmt(stmt)
+	case ForInStmtNT:
+		return env.interpretForInStmt(stmt)
+	case ImportStmtNT:
+		env.interpretImportStmt(stmt)
 	case PrintStmtNT:
 		val := env.interpretExpr(stmt.Right)
-		fmt.Println(val.ToString())
-		next = stmt.Next
+		fmt.Fprintln(env.interp.stdout, val.ToString())
 	case AssignmentNT:
-		next = env.interpretAssignment(stmt)
+		env.interpretAssignment(stmt)
 	case CallNT:
-		next = env.interpretCall(stmt)
+		env.interpretCall(stmt)
 	case ReturnStmtNT:
-		next = env.interpretReturnStmt(stmt)
+		return env.interpretReturnStmt(stmt)
+	case BreakStmtNT, ContinueStmtNT:
+		return stmt
 	default:
-		fmt.Printf("\nRuntime error: \"%s\" is not a statement", stmt.ToString())
-		return nil
+		panic(runtimeErrorf(E0400, "\"%s\" is not a statement", stmt.ToString()))
 	}
-	return next
+	return nil
 }
 
 // interpretExpr dispatches expression nodes to functions that evaluate particular types of expressions
 func (env *Environment) interpretExpr(expr *Node) *Node {
-	result := &Node{Type: NilNT}
+	// errors point at this expression until it's evaluated, then back at the one containing it, so an operator that
+	// fails after evaluating its operands is reported rather than its last operand
+	line, column := env.interp.line, env.interp.column
+	if expr.Line != 0 {
+		env.interp.line, env.interp.column = expr.Line, expr.Column
+	}
+	result := nilValue
 	switch expr.Type {
 	case CallNT:
-		// call can be stmt or expr
-		result = env.interpretCall(expr).Right
-	// case CallableNT:
-	// 	result = env.interpretCallable(n, env)
+		result = env.interpretCall(expr)
+	case GroupNT:
+		result = env.interpretExpr(expr.Right)
+	case AssignmentNT:
+		result = env.interpretAssignment(expr)
+	case ConditionalNT:
+		result = env.interpretConditional(expr)
+	case GetNT:
+		result = env.interpretGet(expr)
+	case IndexNT:
+		result = env.interpretIndex(expr)
+	case SliceNT:
+		result = env.interpretSlice(expr)
+	case ArrayLiteralNT:
+		result = env.interpretArrayLiteral(expr)
+	case LambdaNT:
+		result = env.newFunction(expr)
 	case LogicOrNT:
 		result = env.interpretOr(expr)
 	case LogicAndNT:
@@ -78,22 +246,35 @@ func (env *Environment) interpretExpr(expr *Node) *Node {
 		result = env.interpretFactor(expr)
 	case UnaryNT:
 		result = env.interpretUnary(expr)
+	case IncrementNT:
+		result = env.interpretIncrement(expr)
 	case IdentifierNT, ParamNT:
 		result = env.interpretIdentifier(expr)
-	case NumberNT, StringNT, BoolNT, NilNT, FunctionNT:
+	case NumberNT, DecimalNT, StringNT, BoolNT, NilNT, FunctionNT, CallableNT, ArrayNT, ModuleNT:
 		result = expr
 	}
 
+	env.interp.line, env.interp.column = line, column
 	return result
 }
 
 func (env *Environment) setNativeFunctions() {
-	env.Values["clock"] = &Node{
-		Type:  CallableNT,
-		Data:  []byte{0}, // arity
-		Left:  &Node{Type: IdentifierNT, Data: encodeString("clock")},
-		Right: nil,
-		// TODO
-	}
-
+	env.defineNative("clock", 0, nativeClock)
+	env.defineNative("now", 0, nativeNow)
+	env.defineNative("sleep", 1, nativeSleep)
+	env.defineNative("arity", 1, nativeArity)
+	env.defineNative("name", 1, nativeName)
+	env.defineNative("decimal", 1, nativeDecimal)
+	env.defineNative("len", 1, nativeLen)
+	env.defineNative("substr", 3, nativeSubstr)
+	env.defineNative("indexOf", 2, nativeIndexOf)
+	env.defineNative("split", 2, nativeSplit)
+	env.defineNative("upper", 1, nativeUpper)
+	env.defineNative("lower", 1, nativeLower)
+	env.defineNative("trim", 1, nativeTrim)
+	env.defineNative("argc", 0, nativeArgc)
+	env.defineNative("argv", 1, nativeArgv)
+	env.defineNative("exit", 1, nativeExit)
+	env.defineNative("atExit", 1, nativeAtExit)
+	env.defineNative("assert", 2, nativeAssert)
 }
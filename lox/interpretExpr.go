@@ -1,102 +1,129 @@
 package lox
 
-import "fmt"
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
 
+// interpretConditional evaluates only the branch of cond ? a : b that is chosen
+func (env *Environment) interpretConditional(expr *Node) *Node {
+	if env.interpretExpr(expr.Left).truthy(env.interp.options) {
+		return env.interpretExpr(expr.Right)
+	}
+	return env.interpretExpr(expr.Third)
+}
+
+// interpretOr returns the left operand if it is truthy, without evaluating the right, and otherwise the right operand,
+// so nil or "default" is "default"
 func (env *Environment) interpretOr(expr *Node) *Node {
 	left := env.interpretExpr(expr.Left)
-	if left.truthy() {
+	if left.truthy(env.interp.options) {
 		return left
 	}
-	right := env.interpretExpr(expr.Right)
-	if right.truthy() {
-		return right
-	}
-	return &Node{
-		Type: BoolNT,
-		Data: encodeBool(false),
-	}
+	return env.interpretExpr(expr.Right)
 }
 
+// interpretAnd returns the left operand if it is falsy, without evaluating the right, and otherwise the right operand
 func (env *Environment) interpretAnd(expr *Node) *Node {
 	left := env.interpretExpr(expr.Left)
-	if left.truthy() {
-		right := env.interpretExpr(expr.Right)
-		if right.truthy() {
-			return &Node{
-				Type: BoolNT,
-				Data: encodeBool(true),
-			}
-		}
-	}
-	return &Node{
-		Type: BoolNT,
-		Data: encodeBool(false),
+	if !left.truthy(env.interp.options) {
+		return left
 	}
+	return env.interpretExpr(expr.Right)
 }
 
 func (env *Environment) interpretEquality(expr *Node) *Node {
 	left := env.interpretExpr(expr.Left)
 	right := env.interpretExpr(expr.Right)
+	if env.interp.options.LooseComparison {
+		left, right = coerceNumericStrings(left, right)
+	}
+	equal := left.Type == right.Type && left.Data == right.Data
+	if left.Type == DecimalNT || right.Type == DecimalNT {
+		l, okL := toDecimal(left)
+		r, okR := toDecimal(right)
+		equal = okL && okR && l.Cmp(r) == 0
+	}
+	if left.isCallable() || right.isCallable() {
+		// functions are only equal to themselves, not to every other function with the same arity
+		equal = left == right
+	}
 	switch expr.ToString() {
 	case "==":
-		if left.Type != right.Type {
-			return &Node{
-				Type: BoolNT,
-				Data: encodeBool(false),
-			}
-		}
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(compareValues(left.Data, right.Data)),
-		}
+		return boolNode(equal)
 	case "!=":
-		if left.Type != right.Type {
-			return &Node{
-				Type: BoolNT,
-				Data: encodeBool(true),
-			}
-		}
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(!compareValues(left.Data, right.Data)),
-		}
+		return boolNode(!equal)
 	}
-	fmt.Printf("Runtime error: expected equality expression, instead found \"%s\"", expr.ToString())
-	return nil
+	panic(runtimeErrorf(E0400, "expected equality expression, instead found \"%s\"", expr.ToString()))
 }
 
 func (env *Environment) interpretComparison(expr *Node) *Node {
 	left := env.interpretExpr(expr.Left)
 	right := env.interpretExpr(expr.Right)
+	if env.interp.options.LooseComparison {
+		left, right = coerceNumericStrings(left, right)
+	}
+	if left.Type == DecimalNT || right.Type == DecimalNT {
+		return interpretDecimalComparison(expr.ToString(), left, right)
+	}
 	if left.Type != NumberNT || right.Type != NumberNT {
-		fmt.Printf("\nRuntime error: cannot compare type \"%s\" with type \"%s\"", left.ToString(), right.ToString())
-		return nil
+		panic(runtimeErrorf(E0407, "cannot compare %s \"%s\" with %s \"%s\"", left.typeName(), left.ToString(), right.typeName(), right.ToString()))
 	}
-	numL, numR := decodeLoxNumber(left.Data), decodeLoxNumber(right.Data)
+	numL, numR := left.number(), right.number()
 	switch expr.ToString() {
 	case "<":
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(numL < numR),
-		}
+		return boolNode(numL < numR)
 	case "<=":
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(numL <= numR),
-		}
+		return boolNode(numL <= numR)
 	case ">":
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(numL > numR),
-		}
+		return boolNode(numL > numR)
 	case ">=":
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(numL >= numR),
+		return boolNode(numL >= numR)
+	}
+	panic(runtimeErrorf(E0400, "expected comparison expression, instead found \"%s\"", expr.ToString()))
+}
+
+// coerceNumericStrings converts a string operand holding a number literal to a number when the other operand is a number
+func coerceNumericStrings(left *Node, right *Node) (*Node, *Node) {
+	if left.Type == NumberNT && right.Type == StringNT {
+		if n, ok := parseNumericString(right); ok {
+			return left, n
+		}
+	}
+	if left.Type == StringNT && right.Type == NumberNT {
+		if n, ok := parseNumericString(left); ok {
+			return n, right
 		}
 	}
-	fmt.Printf("\nRuntime error: expected comparison expression, instead found \"%s\"", expr.ToString())
-	return nil
+	return left, right
+}
+
+func parseNumericString(str *Node) (*Node, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(str.Data.String()), 32)
+	if err != nil {
+		return nil, false
+	}
+	return numberNode(NumberValue(f)), true
+}
+
+// concatenate joins right onto the end of left, as print would show left. Strings made by concatenation keep the
+// strings.Builder holding their bytes, and joining onto the longest string a builder has made appends to the builder
+// rather than copying the string, so building up a string in a loop, eg s = s + line, takes linear rather than
+// quadratic time. Earlier strings from the same builder are unaffected, as a builder never changes bytes it has
+// written, and joining onto one of them starts a new builder
+func (env *Environment) concatenate(left *Node, right string) *Node {
+	s := left.ToString()
+	env.interp.allocate(len(s) + len(right))
+	b := left.builder
+	if b == nil || b.Len() != len(s) {
+		b = &strings.Builder{}
+		b.Grow(len(s) + len(right))
+		b.WriteString(s)
+	}
+	b.WriteString(right)
+	return &Node{Type: StringNT, Data: StringValue(b.String()), builder: b}
 }
 
 func (env *Environment) interpretTerm(expr *Node) *Node {
@@ -104,37 +131,38 @@ func (env *Environment) interpretTerm(expr *Node) *Node {
 	case "+":
 		left := env.interpretExpr(expr.Left)
 		right := env.interpretExpr(expr.Right)
+		if (left.Type == StringNT && right.isNumeric()) || (left.isNumeric() && right.Type == StringNT) {
+			// numbers are converted as print would, so "count: " + 3 is "count: 3"
+			return env.concatenate(left, right.ToString())
+		}
+		if left.Type == DecimalNT || right.Type == DecimalNT {
+			return interpretDecimalOp("+", left, right)
+		}
 		if left.Type == NumberNT && right.Type == NumberNT {
-			numL, numR := decodeLoxNumber(left.Data), decodeLoxNumber(right.Data)
-			return &Node{
-				Type: NumberNT,
-				Data: encodeLoxNumber(numL + numR),
-			}
+			numL, numR := left.number(), right.number()
+			return numberNode(NumberValue(numL + numR))
 		}
 		if left.Type == StringNT && right.Type == StringNT {
-			// string concatenation
-			return &Node{
-				Type: StringNT,
-				Data: append(left.Data, right.Data...),
-			}
-		}
-		fmt.Printf("\nRuntime error: cannot add \"%s\" and \"%s\"", left.ToString(), right.ToString())
-		return nil
+			return env.concatenate(left, right.Data.String())
+		}
+		if env.interp.options.Stringify && (left.Type == StringNT || right.Type == StringNT) {
+			// convert the non-string operand as print would, whatever its type
+			return env.concatenate(left, right.ToString())
+		}
+		panic(runtimeErrorf(E0406, "cannot add \"%s\" and \"%s\"", left.ToString(), right.ToString()))
 	case "-":
 		left := env.interpretExpr(expr.Left)
 		right := env.interpretExpr(expr.Right)
-		if left.Type != NumberNT || right.Type != NumberNT {
-			fmt.Printf("\nRuntime error: cannot subtract type \"%s\" and type \"%s\"", left.ToString(), right.ToString())
-			return nil
+		if left.Type == DecimalNT || right.Type == DecimalNT {
+			return interpretDecimalOp("-", left, right)
 		}
-		numL, numR := decodeLoxNumber(left.Data), decodeLoxNumber(right.Data)
-		return &Node{
-			Type: NumberNT,
-			Data: encodeLoxNumber(numL - numR),
+		if left.Type != NumberNT || right.Type != NumberNT {
+			panic(runtimeErrorf(E0406, "cannot subtract type \"%s\" and type \"%s\"", left.ToString(), right.ToString()))
 		}
+		numL, numR := left.number(), right.number()
+		return numberNode(NumberValue(numL - numR))
 	}
-	fmt.Printf("\nRuntime error: expected addition/subtraction expression, instead found \"%s\"", expr.ToString())
-	return nil
+	panic(runtimeErrorf(E0400, "expected addition/subtraction expression, instead found \"%s\"", expr.ToString()))
 }
 
 func (env *Environment) interpretFactor(expr *Node) *Node {
@@ -142,67 +170,116 @@ func (env *Environment) interpretFactor(expr *Node) *Node {
 	case "*":
 		left := env.interpretExpr(expr.Left)
 		right := env.interpretExpr(expr.Right)
-		if left.Type != NumberNT || right.Type != NumberNT {
-			fmt.Printf("\nRuntime error: cannot multiply type \"%s\" and type \"%s\"", left.ToString(), right.ToString())
-			return nil
+		if left.Type == DecimalNT || right.Type == DecimalNT {
+			return interpretDecimalOp("*", left, right)
 		}
-		numL, numR := decodeLoxNumber(left.Data), decodeLoxNumber(right.Data)
-		return &Node{
-			Type: NumberNT,
-			Data: encodeLoxNumber(numL * numR),
+		if left.Type != NumberNT || right.Type != NumberNT {
+			panic(runtimeErrorf(E0406, "cannot multiply type \"%s\" and type \"%s\"", left.ToString(), right.ToString()))
 		}
+		numL, numR := left.number(), right.number()
+		return numberNode(NumberValue(numL * numR))
 	case "/":
 		left := env.interpretExpr(expr.Left)
 		right := env.interpretExpr(expr.Right)
+		if left.Type == DecimalNT || right.Type == DecimalNT {
+			return interpretDecimalOp("/", left, right)
+		}
 		if left.Type != NumberNT || right.Type != NumberNT {
-			fmt.Printf("\nRuntime error: cannot multiply type \"%s\" and type \"%s\"", left.ToString(), right.ToString())
-			return nil
+			panic(runtimeErrorf(E0406, "cannot divide type \"%s\" and type \"%s\"", left.ToString(), right.ToString()))
+		}
+		numL, numR := left.number(), right.number()
+		if numR == 0 {
+			panic(runtimeErrorf(E0408, "division by zero"))
 		}
-		numL, numR := decodeLoxNumber(left.Data), decodeLoxNumber(right.Data)
-		return &Node{
-			Type: NumberNT,
-			Data: encodeLoxNumber(numL / numR),
+		return numberNode(NumberValue(numL / numR))
+	case "%":
+		left := env.interpretExpr(expr.Left)
+		right := env.interpretExpr(expr.Right)
+		if left.Type == DecimalNT || right.Type == DecimalNT {
+			return interpretDecimalOp("%", left, right)
+		}
+		if left.Type != NumberNT || right.Type != NumberNT {
+			panic(runtimeErrorf(E0406, "cannot take the remainder of type \"%s\" and type \"%s\"", left.ToString(), right.ToString()))
 		}
+		// the result has the sign of the left operand, eg -7 % 3 is -1
+		numL, numR := left.number(), right.number()
+		if numR == 0 {
+			panic(runtimeErrorf(E0408, "division by zero"))
+		}
+		return numberNode(NumberValue(math.Mod(float64(numL), float64(numR))))
 	}
-	fmt.Printf("\nRuntime error: expected multiplication/division expression, instead found \"%s\"", expr.ToString())
-	return nil
+	panic(runtimeErrorf(E0400, "expected multiplication/division/remainder expression, instead found \"%s\"", expr.ToString()))
 }
 
 func (env *Environment) interpretUnary(expr *Node) *Node {
 	switch expr.ToString() {
 	case "!":
 		right := env.interpretExpr(expr.Right)
-		return &Node{
-			Type: BoolNT,
-			Data: encodeBool(!right.truthy()),
-		}
+		return boolNode(!right.truthy(env.interp.options))
 	case "-":
 		right := env.interpretExpr(expr.Right)
-		if expr.Type != NumberNT {
-			fmt.Printf("\nRuntime error: operator \"-\" undefined for \"%s\"", expr.ToString())
-			return nil
+		if right.Type == DecimalNT {
+			return &Node{Type: DecimalNT, Data: DecimalValue{new(big.Rat).Neg(right.Data.(DecimalValue).Rat)}}
 		}
-		num := right.Data
-		num[0] ^= 1 << 7
-		return &Node{
-			Type: NumberNT,
-			Data: num,
+		if right.Type != NumberNT {
+			panic(runtimeErrorf(E0406, "operator \"-\" undefined for \"%s\"", right.ToString()))
 		}
+		return numberNode(NumberValue(-right.number()))
 	}
-	fmt.Printf("\nRuntime error: expected unary expression, instead found \"%s\"", expr.ToString())
-	return nil
+	panic(runtimeErrorf(E0400, "expected unary expression, instead found \"%s\"", expr.ToString()))
 }
 
-func (env *Environment) interpretIdentifier(expr *Node) *Node {
+// interpretIncrement adds 1 to a variable or element for ++, or subtracts 1 for --, returning its new value for ++a
+// and the value it had before for a++
+func (env *Environment) interpretIncrement(expr *Node) *Node {
+	target := expr.Right
+	if target == nil {
+		target = expr.Left
+	}
+	var old *Node
+	var arr *ArrayValue
+	var i int
+	if target.Type == IndexNT {
+		// a and i are only evaluated once
+		arr, i = env.interpretIndexTarget(target)
+		old = arr.Elements[i]
+	} else {
+		old = env.interpretIdentifier(target)
+	}
+	if !old.isNumeric() {
+		panic(runtimeErrorf(E0406, "operator \"%s\" undefined for %s \"%s\"", expr.ToString(), old.typeName(), old.ToString()))
+	}
+
+	op := "+"
+	if expr.ToString() == "--" {
+		op = "-"
+	}
 	var val *Node
-	var ok bool
-	name := expr.ToString()
-	for scope := env; !ok && scope != nil; scope = scope.Enclosing {
-		val, ok = scope.Values[name]
+	if old.Type == DecimalNT {
+		val = interpretDecimalOp(op, old, numberNode(1))
+	} else if op == "+" {
+		val = numberNode(NumberValue(old.number() + 1))
+	} else {
+		val = numberNode(NumberValue(old.number() - 1))
 	}
+	if arr != nil {
+		arr.Elements[i] = val
+	} else if !env.set(target, val) {
+		name := target.ToString()
+		panic(runtimeErrorf(E0402, "undeclared variable \"%s\"%s", name, didYouMean(name, env.visibleNames())))
+	}
+
+	if expr.Left != nil {
+		return old
+	}
+	return val
+}
+
+func (env *Environment) interpretIdentifier(expr *Node) *Node {
+	val, ok := env.get(expr)
 	if !ok || val == nil {
-		fmt.Printf("\nRuntime error: undefined variable \"%s\"", name)
-		return nil
+		name := expr.ToString()
+		panic(runtimeErrorf(E0401, "undefined variable \"%s\"%s", name, didYouMean(name, env.visibleNames())))
 	}
 	return val
 }
@@ -2,147 +2,196 @@ package lox
 
 import "fmt"
 
-func (env *Environment) interpretVarDecl(stmt *Node) *Node {
-	name := stmt.Left.ToString()
-	if _, already := env.Values[name]; already {
-		fmt.Printf("\nRuntime error: variable \"%s\" redeclared", name)
-		return nil
+func (env *Environment) interpretVarDecl(stmt *Node) {
+	if env.defined(stmt.Left) && !env.mayRedeclare(stmt.Left) {
+		panic(runtimeErrorf(E0403, "variable \"%s\" redeclared", stmt.Left.ToString()))
+	}
+	val := nilValue // variables declared without a value are nil
+	if stmt.Right != nil {
+		val = env.interpretExpr(stmt.Right)
+	}
+	env.define(stmt.Left, val)
+}
+
+func (env *Environment) interpretFunDecl(stmt *Node) {
+	if env.defined(stmt.Left) && !env.mayRedeclare(stmt.Left) {
+		panic(runtimeErrorf(E0403, "function \"%s\" redeclared", stmt.Left.ToString()))
 	}
-	val := env.interpretExpr(stmt.Right)
-	env.Values[name] = val
 
-	return stmt.Next
+	env.define(stmt.Left, env.newFunction(stmt))
 }
 
-func (env *Environment) interpretFunDecl(stmt *Node) *Node {
-	name := stmt.Left.ToString()
-	if _, already := env.Values[name]; already {
-		fmt.Printf("\nRuntime error: function \"%s\" redeclared", name)
-		return nil
+// mayRedeclare reports whether the name ident declares may be declared again in env, as globals can in an interactive
+// session. A script may also replace a native function with a global of its own, so adding a native, such as assert(),
+// doesn't break scripts that already declare one of the same name
+func (env *Environment) mayRedeclare(ident *Node) bool {
+	if env != env.global {
+		return false
 	}
+	return env.interp.session || env.Values[ident.ToString()].Type == CallableNT
+}
 
-	env.Values[name] = &Node{
+// newFunction creates a function value from a declaration or anonymous function, closing over env
+func (env *Environment) newFunction(decl *Node) *Node {
+	return &Node{
 		Type:  FunctionNT,
-		Data:  stmt.Data,  // arity (number)
-		Left:  stmt.Right, // params, connected by Next
-		Right: stmt.Third, // function body
-	}
+		Data:  decl.Data,  // arity (number)
+		Left:  decl.Right, // params, connected by Next
+		Right: decl.Third, // function body
+		Third: decl.Left,  // name, or nil for anonymous functions
 
-	return stmt.Next
+		closure: env,
+		locals:  decl.locals, // the parameters' slots
+	}
 }
 
 func (env *Environment) interpretBlock(stmt *Node) *Node {
-	scope := &Environment{Enclosing: env, Values: make(map[string]*Node)}
-	next := stmt.Right
-	for next != nil {
-		if next.Type == ReturnStmtNT {
-			// break block for return stmts
-			return &Node{
-				Type:  ReturnStmtNT,
-				Right: scope.interpretExpr(next.Right),
-				Next:  stmt.Next,
-			}
-		}
-		next = scope.interpretStmt(next)
-	}
-	return stmt.Next
+	scope := env.newScope(stmt.locals)
+	defer scope.closeScope()
+	return scope.interpretStmts(stmt.Right)
 }
 
 func (env *Environment) interpretIfStmt(stmt *Node) *Node {
 	cond := env.interpretExpr(stmt.Left)
-	if cond.truthy() {
-		stmt.Right.Next = stmt.Next
-		return stmt.Right
+	if cond.truthy(env.interp.options) {
+		return env.interpretStmt(stmt.Right)
 	}
 	if stmt.Third != nil {
-		stmt.Third.Next = stmt.Next
-		return stmt.Third
+		return env.interpretStmt(stmt.Third)
 	}
-	return stmt.Next
+	return nil
 }
 
 func (env *Environment) interpretWhileStmt(stmt *Node) *Node {
-	scope := &Environment{Enclosing: env, Values: make(map[string]*Node)}
-	for cond := scope.interpretExpr(stmt.Left); cond.truthy(); cond = scope.interpretExpr(stmt.Left) {
-		res := scope.interpretStmt(stmt.Right)
-		if res != nil && res.Type == ReturnStmtNT {
-			// break loop for return stmts
-			return &Node{
-				Type:  ReturnStmtNT,
-				Right: scope.interpretExpr(res.Right),
-				Next:  stmt.Next,
+	scope := env.newScope(stmt.locals)
+	defer scope.closeScope()
+	for cond := scope.interpretExpr(stmt.Left); cond.truthy(env.interp.options); cond = scope.interpretExpr(stmt.Left) {
+		if result := scope.interpretStmt(stmt.Right); result != nil {
+			if result.Type == BreakStmtNT {
+				return nil
+			}
+			if result.Type != ContinueStmtNT {
+				// return from inside the loop
+				return result
 			}
 		}
+		if stmt.Third != nil {
+			// a for loop's increment
+			scope.interpretStmt(stmt.Third)
+		}
 	}
-	return stmt.Next
+	return nil
 }
 
+// interpretForInStmt runs the body of a for-in loop once for each element of a collection. Each iteration has a scope
+// of its own holding the loop variable, so functions declared in the body see the element from their own iteration
+func (env *Environment) interpretForInStmt(stmt *Node) *Node {
+	next := iterate(env.interpretExpr(stmt.Right))
+	for elem, ok := next(); ok; elem, ok = next() {
+		scope := env.newScope(stmt.locals)
+		scope.define(stmt.Left, elem)
+		result := scope.interpretStmt(stmt.Third)
+		scope.closeScope()
+		if result != nil {
+			if result.Type == BreakStmtNT {
+				return nil
+			}
+			if result.Type != ContinueStmtNT {
+				// return from inside the loop
+				return result
+			}
+		}
+	}
+	return nil
+}
+
+// interpretAssignment stores a new value in an existing variable or array element, and returns the value, so
+// assignments can be chained
 func (env *Environment) interpretAssignment(stmt *Node) *Node {
+	if stmt.Left.Type == IndexNT {
+		return env.interpretSetIndex(stmt)
+	}
 	name := stmt.Left.ToString()
 	val := env.interpretExpr(stmt.Right)
 
-	for scope := env; scope != nil; scope = scope.Enclosing {
-		_, ok := scope.Values[name]
-		if ok {
-			scope.Values[name] = val
-			return stmt.Next
-		}
+	if env.set(stmt.Left, val) {
+		return val
 	}
 
-	fmt.Printf("\nRuntime error: undeclared variable \"%s\"", name)
-	return nil
+	panic(runtimeErrorf(E0402, "undeclared variable \"%s\"%s", name, didYouMean(name, env.visibleNames())))
 }
 
+// interpretCall evaluates the callee and arguments of a call, runs the function body, and returns the function's return value
 func (env *Environment) interpretCall(stmt *Node) *Node {
-	// TODO: nested calls, eg foo(bar)(baz)()
-	if stmt.Left.Type != IdentifierNT {
-		fmt.Printf("\nRuntime error: \"%s\" is not callable", stmt.ToString())
-		return nil
+	fun := env.interpretExpr(stmt.Left)
+	args := []*Node{}
+	for arg := stmt.Right; arg != nil; arg = arg.Next {
+		args = append(args, env.interpretExpr(arg))
 	}
+	return env.call(fun, args)
+}
 
-	name := stmt.Left.ToString()
-	var fun *Node
-	var ok bool
-	for scope := env; !ok && scope != nil; scope = scope.Enclosing {
-		fun, ok = scope.Values[name]
+// call runs a function value with arguments that have already been evaluated, and returns the function's return value
+func (env *Environment) call(fun *Node, args []*Node) *Node {
+	if !fun.isCallable() {
+		panic(runtimeErrorf(E0404, "\"%s\" is not callable", fun.ToString()))
+	}
+	if max := env.interp.limits.MaxCallDepth; max > 0 && len(env.interp.frames) >= max {
+		panic(&LimitExceededError{Limit: "MaxCallDepth", Message: fmt.Sprintf("more than %d calls in progress", max)})
 	}
-	if !ok || fun == nil {
-		fmt.Printf("\nRuntime error: Function %s is undefined", name)
-		return nil
+	if max := env.interp.options.maxStack(); len(env.interp.frames) >= max {
+		panic(runtimeErrorf(E0417, "stack overflow calling %s(), with %d calls already in progress", fun.functionName(), max))
 	}
+	// frames are left in place when a runtime error unwinds the call, so the error can report them
+	env.interp.frames = append(env.interp.frames, fun)
+	line, column := env.interp.line, env.interp.column
+	if on := env.interp.hooks.OnCall; on != nil {
+		on(fun.functionName(), args)
+	}
+	result := env.callFunction(fun, args)
+	if on := env.interp.hooks.OnReturn; on != nil {
+		on(fun.functionName(), result)
+	}
+	env.interp.frames = env.interp.frames[:len(env.interp.frames)-1]
+	env.interp.line, env.interp.column = line, column // back to the call
+	return result
+}
 
-	// set up function's environment with param values
-	funcEnv := &Environment{
-		Enclosing: env,
-		Values:    make(map[string]*Node),
+func (env *Environment) callFunction(fun *Node, args []*Node) *Node {
+	if fun.Type == CallableNT {
+		return env.callNative(fun, args)
 	}
-	for arg, param := stmt.Right, fun.Left; arg != nil || param != nil; arg, param = arg.Next, param.Next {
-		if arg == nil && param != nil {
-			fmt.Printf("\nRuntime error: Too few parameters for function %s, (expected %f)", stmt.Left.ToString(), decodeLoxNumber(fun.Data))
-			return nil
-		}
-		if param == nil && arg != nil {
-			fmt.Printf("\nRuntime error: Too many parameters for function %s, (expected %f)", stmt.Left.ToString(), decodeLoxNumber(fun.Data))
-			return nil
+
+	// set up function's environment with param values, nested in the scope the function was declared in so it can see
+	// the variables around its declaration, even after that scope has finished
+	funcEnv := fun.closure.newScope(fun.locals)
+	defer funcEnv.closeScope()
+	param := fun.Left
+	for _, arg := range args {
+		if param == nil {
+			panic(runtimeErrorf(E0405, "Too many arguments for %s", fun.ToString()))
 		}
-		val := funcEnv.interpretExpr(arg)
-		funcEnv.Values[param.ToString()] = val
+		funcEnv.define(param, arg)
+		param = param.Next
+	}
+	if param != nil {
+		panic(runtimeErrorf(E0405, "Too few arguments for %s", fun.ToString()))
 	}
 
 	// execute function
-	result := funcEnv.interpretStmt(fun.Right)
-	if result.Type == ReturnStmtNT {
-		// when call is expr, return return stmt, but set next stmt to stmt following call
-		return &Node{
-			Type:  ReturnStmtNT,
-			Right: funcEnv.interpretExpr(result.Right),
-			Next:  stmt.Next,
-		}
+	// a break or continue outside any loop can only be in a program that wasn't resolved, and ends the function like
+	// "return;"
+	if result := funcEnv.interpretStmt(fun.Right); result != nil && result.Type != BreakStmtNT && result.Type != ContinueStmtNT {
+		return result
 	}
-
-	return stmt.Next // when call is stmt, return next stmt
+	return nilValue // functions without a return value return nil
 }
 
+// interpretReturnStmt evaluates the value being returned, which is passed back up through the statements enclosing it
+// until it reaches the function call
 func (env *Environment) interpretReturnStmt(stmt *Node) *Node {
-	return stmt
+	if stmt.Right == nil {
+		return nilValue
+	}
+	return env.interpretExpr(stmt.Right)
 }
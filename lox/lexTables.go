@@ -0,0 +1,125 @@
+package lox
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// charClass groups the characters which start the same kind of token, so the lexer can dispatch on a table lookup
+type charClass uint8
+
+// charClass values
+const (
+	invalidClass  charClass = iota
+	spaceClass              // ' ', '\t', '\r'
+	newlineClass            // '\n'
+	singleClass             // always a single-character token
+	operatorClass           // a token that may be followed by '=', eg "<" and "<=", or by itself, eg "+" and "++"
+	slashClass              // '/', either Slash, SlashEqual or the start of a comment
+	quoteClass              // '"', the start of a string
+	digitClass              // the start of a number
+	alphaClass              // the start of an identifier or keyword
+)
+
+// charClasses classifies the ASCII characters. Other characters are handled by classOf
+var charClasses [utf8.RuneSelf]charClass
+
+// singleTokens maps single-character tokens to their type
+var singleTokens [utf8.RuneSelf]TokenType
+
+// operatorTokens maps the first character of 1-2 character tokens to their type alone, and followed by '='
+var operatorTokens [utf8.RuneSelf][2]TokenType
+
+// doubledTokens maps the operators that can also be written twice to the token they make, eg "++"
+var doubledTokens = map[rune]TokenType{
+	'+': PlusPlus,
+	'-': MinusMinus,
+}
+
+// classOf is the class of any character. Beyond ASCII, letters may start identifiers, and nothing else starts a token
+func classOf(r rune) charClass {
+	if r < utf8.RuneSelf {
+		return charClasses[r]
+	}
+	if unicode.IsLetter(r) {
+		return alphaClass
+	}
+	return invalidClass
+}
+
+// keywordNode is a node in a trie of the keywords, letting the lexer recognize keywords while it scans an identifier
+type keywordNode struct {
+	children  [26]*keywordNode // keywords are all lowercase ASCII
+	isKeyword bool
+	keyword   TokenType
+}
+
+var keywordTrie = &keywordNode{}
+
+// step follows the trie to the next character of an identifier, returning nil if no keyword continues with r
+func (kw *keywordNode) step(r rune) *keywordNode {
+	if kw == nil || r < 'a' || r > 'z' {
+		return nil
+	}
+	return kw.children[r-'a']
+}
+
+func init() {
+	for _, r := range " \t\r" {
+		charClasses[r] = spaceClass
+	}
+	charClasses['\n'] = newlineClass
+	for r, t := range map[byte]TokenType{
+		'(': LeftParen,
+		')': RightParen,
+		'{': LeftBrace,
+		'}': RightBrace,
+		'[': LeftBracket,
+		']': RightBracket,
+		',': Comma,
+		'.': Dot,
+		';': Semicolon,
+		'?': Question,
+		':': Colon,
+	} {
+		charClasses[r] = singleClass
+		singleTokens[r] = t
+	}
+	for r, t := range map[byte][2]TokenType{
+		'!': {Bang, BangEqual},
+		'=': {Equal, EqualEqual},
+		'<': {Less, LessEqual},
+		'>': {Greater, GreaterEqual},
+		'-': {Minus, MinusEqual},
+		'+': {Plus, PlusEqual},
+		'*': {Star, StarEqual},
+		'%': {Percent, PercentEqual},
+	} {
+		charClasses[r] = operatorClass
+		operatorTokens[r] = t
+	}
+	charClasses['/'] = slashClass
+	charClasses['"'] = quoteClass
+	for r := '0'; r <= '9'; r++ {
+		charClasses[r] = digitClass
+	}
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		if isAlpha(r) {
+			charClasses[r] = alphaClass
+		}
+	}
+
+	for word, t := range keywords {
+		node := keywordTrie
+		for i := 0; i < len(word); i++ {
+			next := node.children[word[i]-'a']
+			if next == nil {
+				next = &keywordNode{}
+				node.children[word[i]-'a'] = next
+			}
+			node = next
+		}
+		node.isKeyword = true
+		node.keyword = t
+	}
+}
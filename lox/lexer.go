@@ -1,330 +1,335 @@
 package lox
 
-import "fmt"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 var keywords = map[string]TokenType{
-	"and":    And,
-	"class":  Class,
-	"else":   Else,
-	"false":  False,
-	"fun":    Fun,
-	"for":    For,
-	"if":     If,
-	"nil":    Nil,
-	"or":     Or,
-	"print":  Print,
-	"return": Return,
-	"super":  Super,
-	"this":   This,
-	"true":   True,
-	"var":    Var,
-	"while":  While,
+	"and":      And,
+	"break":    Break,
+	"class":    Class,
+	"continue": Continue,
+	"else":     Else,
+	"false":    False,
+	"fun":      Fun,
+	"for":      For,
+	"if":       If,
+	"import":   Import,
+	"in":       In,
+	"nil":      Nil,
+	"or":       Or,
+	"print":    Print,
+	"return":   Return,
+	"super":    Super,
+	"this":     This,
+	"true":     True,
+	"var":      Var,
+	"while":    While,
 }
 
-// Lex is the wrapper function for the tail-recursive lex()
+// Keywords lists Lox's reserved words in alphabetical order, eg for an editor to complete them
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Lex scans source into a slice of Token, ending with an EOF token
 func Lex(source string) ([]Token, error) {
-	tokens := make([]Token, 0)
-	return lex(tokens, source, 1, nil)
+	return LexReporting(source, nil)
 }
 
-func newToken(ttype TokenType, value string, line int) Token {
-	return Token{
-		Type:   ttype,
-		Lexeme: value,
-		Line:   line,
+// LexReporting is like Lex, but sends warnings, such as for a malformed number literal, to r
+func LexReporting(source string, r ErrorReporter) ([]Token, error) {
+	tokens := make([]Token, 0, len(source)/4)
+	s := NewScanner(strings.NewReader(source))
+	s.Reporter = r
+	for {
+		tok, err := s.Next()
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens, nil
+		}
 	}
 }
 
-// skipComment recurses through a string until finding a newline and returns the rest of the input string
-func skipComment(tail string) string {
-	if len(tail) <= 0 {
-		return ""
-	} else if tail[0] == '\n' {
-		return tail[1:]
-	} else {
-		return skipComment(tail[1:])
+// Scanner reads tokens one at a time from an io.Reader, so huge scripts and piped input can be lexed as they are read,
+// without holding the whole source in memory
+type Scanner struct {
+	r      *bufio.Reader
+	line   int
+	column int // of the next character
+	offset int // byte offset of the next character
+	lexeme strings.Builder
+	err    error // stops the scanner, returned from every later call to Next
+
+	comments []Comment // skipped since the last token, to go with the next
+
+	// Reporter receives warnings about the source, if it is set
+	Reporter ErrorReporter
+}
+
+// Comment is a "//" comment in the source. The Scanner keeps the comments it skips over in the Comments of the token
+// after them, and Parse moves them onto the statements they belong to, so tools such as golox fmt can put them back
+type Comment struct {
+	Text   string // including the "//", without the newline
+	Line   int
+	Column int
+}
+
+// NewScanner creates a Scanner reading source code from r
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReader(r), line: 1, column: 1}
+}
+
+// Next returns the next token in the source, holding any comments skipped before it. Once the source is used up it
+// returns an EOF token, and keeps returning EOF tokens if called again. After an error, such as a *LexError, it keeps
+// returning the same error
+func (s *Scanner) Next() (Token, error) {
+	tok, err := s.next()
+	if err == nil {
+		tok.Comments, s.comments = s.comments, nil
 	}
+	return tok, err
 }
 
-// takes a string and recurses through it until finding a closing '"' rune
-// returns the tail, current string, and number of lines
-func findString(tail string, current string, lines int) (string, string, int) {
-	if len(tail) <= 0 {
-		return "", current, lines
-	} else if tail[0] == '"' {
-		return tail[1:], current, lines
-	} else if tail[0] == '\n' {
-		return findString(tail[1:], current+string(tail[0]), lines+1)
-	} else {
-		return findString(tail[1:], current+string(tail[0]), lines)
+func (s *Scanner) next() (Token, error) {
+	if s.err != nil {
+		return Token{}, s.err
+	}
+	for {
+		line, column, start := s.line, s.column, s.offset
+		r, ok := s.read()
+		if !ok {
+			if s.err != nil {
+				return Token{}, s.err
+			}
+			return newToken(EOF, "\x00", line, column, start), nil
+		}
+
+		switch classOf(r) {
+		case newlineClass, spaceClass:
+			continue
+
+		case singleClass:
+			return newToken(singleTokens[r], string(r), line, column, start), nil
+
+		// 1-2 characters: the operator alone, or followed by "="
+		case operatorClass:
+			if s.match('=') {
+				return newToken(operatorTokens[r][1], string(r)+"=", line, column, start), nil
+			}
+			if doubled, ok := doubledTokens[r]; ok && s.match(r) {
+				return newToken(doubled, string(r)+string(r), line, column, start), nil
+			}
+			return newToken(operatorTokens[r][0], string(r), line, column, start), nil
+
+		// slash - either Slash, SlashEqual or Comment
+		case slashClass:
+			if s.match('/') {
+				s.skipComment(line, column)
+				continue
+			}
+			if s.match('=') {
+				return newToken(SlashEqual, "/=", line, column, start), nil
+			}
+			return newToken(Slash, string(r), line, column, start), nil
+
+		// strings
+		case quoteClass:
+			val, closed := s.findString()
+			if !closed {
+				s.err = &LexError{Code: E0102, Line: line, Column: column, Lexeme: "\"", Message: fmt.Sprintf("Unterminated string starting at line %d", line)}
+				return Token{}, s.err
+			}
+			tok := newToken(String, val, line, column, start)
+			tok.Length = s.offset - start // including the quotes
+			return tok, nil
+
+		// numbers
+		case digitClass:
+			return newToken(Number, s.findNumber(r), line, column, start), nil
+
+		// identifiers and keywords
+		case alphaClass:
+			val, kw := s.findIdentifier(r)
+			if kw != nil && kw.isKeyword {
+				return newToken(kw.keyword, val, line, column, start), nil
+			}
+			return newToken(Identifier, val, line, column, start), nil
+
+		default:
+			s.err = &LexError{Code: E0101, Line: line, Column: column, Lexeme: string(r), Message: fmt.Sprintf("unexpected character \"%s\"", string(r))}
+			return Token{}, s.err
+		}
 	}
 }
 
-// takes a string and recurses through it until finding a non-numeric rune or a second '.'
-// returns the rest of the input string, the current string representing the number, and a bool denoting whether a decimal point has been seen
-func findNumber(tail string, current string, dotSeen bool) (string, string, bool) {
-	if len(tail) <= 0 {
-		return "", current, dotSeen
-	} else if !isDigit(tail[0]) && tail[0] != '.' {
-		return tail, current, dotSeen
-	} else if tail[0] == '.' && dotSeen {
-		fmt.Printf("Warning: malformed number literal \"%s\"", current+".")
-		return tail[1:], current, dotSeen
-	} else if tail[0] == '.' && !dotSeen {
-		return findNumber(tail[1:], current+string(tail[0]), true)
-	} else {
-		return findNumber(tail[1:], current+string(tail[0]), dotSeen)
+// newToken creates a token starting at byte offset start in the source, spanning its lexeme
+func newToken(ttype TokenType, value string, line int, column int, start int) Token {
+	length := len(value)
+	if ttype == EOF {
+		length = 0
+	}
+	return Token{
+		Type:   ttype,
+		Lexeme: value,
+		Line:   line,
+		Column: column,
+		Start:  start,
+		Length: length,
 	}
 }
 
-func findIdentifier(tail string, current string) (string, string) {
-	if len(tail) <= 0 {
-		return "", current
-	} else if !isAlphaNumeric(tail[0]) {
-		return tail, current
+// read consumes the next character, decoding it from UTF-8 and keeping track of the line and column. It returns false at
+// the end of the source, or if reading fails, in which case the error is kept in s.err. Bytes that aren't valid UTF-8
+// are read as utf8.RuneError
+func (s *Scanner) read() (rune, bool) {
+	r, size, err := s.r.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		return 0, false
+	}
+	s.offset += size
+	if r == '\n' {
+		s.line++
+		s.column = 1
 	} else {
-		return findIdentifier(tail[1:], current+string(tail[0]))
+		s.column++
 	}
+	return r, true
 }
 
-func isAlpha(r byte) bool {
-	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+// peek returns the character after the next n characters without consuming it, or false if the source ends first
+func (s *Scanner) peek(n int) (rune, bool) {
+	b, err := s.r.Peek((n + 1) * utf8.UTFMax)
+	for ; n > 0 && len(b) > 0; n-- {
+		_, size := utf8.DecodeRune(b)
+		b = b[size:]
+	}
+	if len(b) == 0 {
+		if err != nil && err != io.EOF {
+			s.err = err
+		}
+		return 0, false
+	}
+	r, _ := utf8.DecodeRune(b)
+	return r, true
 }
 
-func isDigit(r byte) bool {
-	return r >= '0' && r <= '9'
+// match consumes the next character if it is r
+func (s *Scanner) match(r rune) bool {
+	if next, ok := s.peek(0); ok && next == r {
+		s.read()
+		return true
+	}
+	return false
 }
 
-func isAlphaNumeric(r byte) bool {
-	return isAlpha(r) || isDigit(r)
+// skipComment consumes the rest of a line, keeping the comment that started at line and column
+func (s *Scanner) skipComment(line int, column int) {
+	s.lexeme.Reset()
+	s.lexeme.WriteString("//")
+	for {
+		r, ok := s.read()
+		if !ok || r == '\n' {
+			s.comments = append(s.comments, Comment{Text: strings.TrimRight(s.lexeme.String(), " \t\r"), Line: line, Column: column})
+			return
+		}
+		s.lexeme.WriteRune(r)
+	}
 }
 
-// lex is the tail-recursive helper function for Lex()
-// it is the main lexing switch, recursing through the string and matching tokens
-// that it appends to the current slice of Token, along with tracking line number
-func lex(current []Token, tail string, line int, err error) ([]Token, error) {
-	if err != nil {
-		return current, err
-	}
-	if len(tail) == 0 {
-		return append(current, newToken(EOF, "\x00", line)), nil
+// findString consumes a string up to and including its closing '"', and returns its contents. closed is false if the
+// source ends before the string does
+func (s *Scanner) findString() (val string, closed bool) {
+	s.lexeme.Reset()
+	for {
+		r, ok := s.read()
+		if !ok {
+			return s.lexeme.String(), false
+		}
+		if r == '"' {
+			return s.lexeme.String(), true
+		}
+		s.lexeme.WriteRune(r)
 	}
-	r := tail[0]
-	switch r {
-	// whitespace
-	case '\n':
-		return lex(current, tail[1:], line+1, nil)
-	case '\t':
-		return lex(current, tail[1:], line, nil)
-	case '\r':
-		return lex(current, tail[1:], line, nil)
-	case ' ':
-		return lex(current, tail[1:], line, nil)
-
-	// single-character tokens
-	case '(':
-		return lex(
-			append(current, newToken(LeftParen, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case ')':
-		return lex(
-			append(current, newToken(RightParen, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case '{':
-		return lex(
-			append(current, newToken(LeftBrace, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case '}':
-		return lex(
-			append(current, newToken(RightBrace, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case ',':
-		return lex(
-			append(current, newToken(Comma, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case '.':
-		return lex(
-			append(current, newToken(Dot, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case '-':
-		return lex(
-			append(current, newToken(Minus, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case '+':
-		return lex(
-			append(current, newToken(Plus, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case ';':
-		return lex(
-			append(current, newToken(Semicolon, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
-	case '*':
-		return lex(
-			append(current, newToken(Star, string(r), line)),
-			tail[1:],
-			line,
-			nil,
-		)
+}
 
-	// 1-2 characters
-	case '!':
-		{
-			if tail[1] == '=' {
-				return lex(
-					append(current, newToken(BangEqual, "!=", line)),
-					tail[2:],
-					line,
-					nil,
-				)
-			}
-			return lex(
-				append(current, newToken(Bang, string(r), line)),
-				tail[1:],
-				line,
-				nil,
-			)
-		}
-	case '=':
-		{
-			if tail[1] == '=' {
-				return lex(
-					append(current, newToken(EqualEqual, "==", line)),
-					tail[2:],
-					line,
-					nil,
-				)
-			}
-			return lex(
-				append(current, newToken(Equal, string(r), line)),
-				tail[1:],
-				line,
-				nil,
-			)
+// findNumber consumes the rest of a number literal starting with first, stopping at a non-numeric character, a second
+// '.', or a '.' not followed by a digit, and returns the literal
+func (s *Scanner) findNumber(first rune) string {
+	s.lexeme.Reset()
+	s.lexeme.WriteRune(first)
+	dotSeen := false
+	for {
+		r, ok := s.peek(0)
+		if !ok {
+			break
 		}
-	case '<':
-		{
-			if tail[1] == '=' {
-				return lex(
-					append(current, newToken(LessEqual, "<=", line)),
-					tail[2:],
-					line,
-					nil,
-				)
+		if r == '.' {
+			if next, ok := s.peek(1); !ok || !isDigit(next) {
+				break // method call on a number literal, eg 3.floor()
 			}
-			return lex(
-				append(current, newToken(Less, string(r), line)),
-				tail[1:],
-				line,
-				nil,
-			)
-		}
-	case '>':
-		{
-			if tail[1] == '=' {
-				return lex(
-					append(current, newToken(GreaterEqual, ">=", line)),
-					tail[2:],
-					line,
-					nil,
-				)
+			if dotSeen {
+				warn(s.Reporter, StageLex, W0101, s.line, s.column, "malformed number literal \"%s\", with a second \".\"", s.lexeme.String()+".")
+				s.read() // skip the second '.'
+				break
 			}
-			return lex(
-				append(current, newToken(Greater, string(r), line)),
-				tail[1:],
-				line,
-				nil,
-			)
+			dotSeen = true
+		} else if !isDigit(r) {
+			break
 		}
+		s.read()
+		s.lexeme.WriteRune(r)
+	}
+	return s.lexeme.String()
+}
 
-	// slash - either Slash or Comment
-	case '/':
-		{
-			if tail[1] == '/' {
-				return lex(
-					current,
-					skipComment(tail[2:]),
-					line+1,
-					nil,
-				)
-			}
-			return lex(
-				append(current, newToken(Slash, string(r), line)),
-				tail[1:],
-				line,
-				nil,
-			)
+// findIdentifier consumes the rest of an identifier starting with first, following the keyword trie along the way. It
+// returns the identifier and the trie node it ends on, which is nil once the identifier can't be a keyword
+func (s *Scanner) findIdentifier(first rune) (string, *keywordNode) {
+	s.lexeme.Reset()
+	s.lexeme.WriteRune(first)
+	kw := keywordTrie.step(first)
+	for {
+		r, ok := s.peek(0)
+		if !ok || !isIdentifierChar(r) {
+			return s.lexeme.String(), kw
 		}
+		s.read()
+		s.lexeme.WriteRune(r)
+		kw = kw.step(r)
+	}
+}
 
-	// strings
-	case '"':
-		newTail, val, lines := findString(tail[1:], "", 0)
-		return lex(
-			append(current, newToken(String, val, line)),
-			newTail,
-			line+lines,
-			nil,
-		)
+func isAlpha(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
 
-	default:
-		{
-			// numbers
-			if isDigit(r) {
-				newTail, val, _ := findNumber(tail[1:], string(tail[0]), false)
-				return lex(
-					append(current, newToken(Number, val, line)),
-					newTail,
-					line,
-					nil,
-				)
-				// identifiers
-			} else if isAlpha(r) {
-				newTail, val := findIdentifier(tail[1:], string(tail[0]))
-				ttype, isKeyword := keywords[val]
-				if isKeyword {
-					return lex(
-						append(current, newToken(ttype, val, line)),
-						newTail,
-						line,
-						nil,
-					)
-				}
-				return lex(
-					append(current, newToken(Identifier, val, line)),
-					newTail,
-					line,
-					nil,
-				)
-			} else {
-				err = fmt.Errorf("Lexing error at line %d: unexpected character \"%s\"", line, string(r))
-				return current, err
-			}
-		}
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// isIdentifierChar reports whether r can continue an identifier: an ASCII letter or digit, or any Unicode letter or
+// digit
+func isIdentifierChar(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isAlpha(r) || isDigit(r)
 	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
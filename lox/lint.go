@@ -0,0 +1,246 @@
+package lox
+
+import "sort"
+
+// LintRules selects the checks Lint makes. Unused local variables are reported by Resolve instead, as W0301
+type LintRules struct {
+	UnusedGlobals      bool // W0401: global variables and functions that are never used
+	Shadowing          bool // W0402: declarations hiding a variable of the same name in an enclosing scope
+	SelfAssignment     bool // W0403: assignments of a variable to itself
+	ConstantConditions bool // W0404: conditions that are always true or always false
+	EmptyBlocks        bool // W0405: blocks with nothing in them, other than function bodies
+	LongParameterLists bool // W0406: functions with more than MaxParams parameters
+	MaxParams          int
+}
+
+// DefaultLintRules enables every check, allowing functions up to 5 parameters
+func DefaultLintRules() LintRules {
+	return LintRules{
+		UnusedGlobals:      true,
+		Shadowing:          true,
+		SelfAssignment:     true,
+		ConstantConditions: true,
+		EmptyBlocks:        true,
+		LongParameterLists: true,
+		MaxParams:          5,
+	}
+}
+
+// Lint looks for code in a parsed program that is legal but likely to be a mistake or hard to read, reporting each
+// finding to r as a warning. It doesn't need the program to be resolved
+func Lint(prgm *Node, rules LintRules, r ErrorReporter) {
+	l := &linter{rules: rules, reporter: r, reads: map[string]bool{}}
+	l.beginScope()
+	l.stmts(prgm.Right)
+
+	// globals may be read by functions declared before them, so they are only checked once the program has been read
+	globals := l.scopes[0]
+	if rules.UnusedGlobals {
+		decls := []*Node{}
+		for name, decl := range globals {
+			if !l.reads[name] {
+				decls = append(decls, decl)
+			}
+		}
+		sort.Slice(decls, func(i, j int) bool {
+			a, b := decls[i], decls[j]
+			return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+		})
+		for _, decl := range decls {
+			kind := "variable"
+			switch decl.Type {
+			case FunDeclNT:
+				kind = "function"
+			case ImportStmtNT:
+				kind = "module"
+			}
+			l.warn(W0401, decl, "global %s \"%s\" is never used", kind, decl.Left.ToString())
+		}
+	}
+}
+
+type linter struct {
+	rules    LintRules
+	reporter ErrorReporter
+
+	scopes []map[string]*Node // declarations in each scope, innermost last
+	reads  map[string]bool    // names read that weren't declared in a local scope, so may be globals
+}
+
+func (l *linter) warn(code Code, at *Node, format string, a ...interface{}) {
+	warn(l.reporter, StageLint, code, at.Line, at.Column, format, a...)
+}
+
+func (l *linter) beginScope() {
+	l.scopes = append(l.scopes, map[string]*Node{})
+}
+
+func (l *linter) endScope() {
+	l.scopes = l.scopes[:len(l.scopes)-1]
+}
+
+// declare adds a declaration to the innermost scope, after checking whether it hides one in an enclosing scope. decl
+// is the VarDeclNT, FunDeclNT or other node declaring name
+func (l *linter) declare(name string, decl *Node) {
+	if l.rules.Shadowing {
+		for i := len(l.scopes) - 2; i >= 0; i-- {
+			if outer, ok := l.scopes[i][name]; ok {
+				l.warn(W0402, decl, "\"%s\" shadows the variable declared on line %d", name, outer.Line)
+				break
+			}
+		}
+	}
+	l.scopes[len(l.scopes)-1][name] = decl
+}
+
+// read records a variable being read, from the innermost scope that declares it
+func (l *linter) read(name string) {
+	for i := len(l.scopes) - 1; i > 0; i-- {
+		if _, ok := l.scopes[i][name]; ok {
+			return
+		}
+	}
+	l.reads[name] = true
+}
+
+func (l *linter) stmts(stmt *Node) {
+	for ; stmt != nil; stmt = stmt.Next {
+		l.stmt(stmt)
+	}
+}
+
+func (l *linter) stmt(stmt *Node) {
+	switch stmt.Type {
+	case DeclarationNT, StmtNT:
+		l.stmt(stmt.Right)
+	case VarDeclNT:
+		if stmt.Right != nil {
+			l.expr(stmt.Right)
+		}
+		l.declare(stmt.Left.ToString(), stmt)
+	case FunDeclNT:
+		l.declare(stmt.Left.ToString(), stmt)
+		l.function(stmt)
+	case ImportStmtNT:
+		l.declare(stmt.Left.ToString(), stmt)
+	case BlockNT:
+		if stmt.Right == nil && (stmt.Trivia == nil || len(stmt.Trivia.Closing) == 0) && l.rules.EmptyBlocks {
+			l.warn(W0405, stmt, "empty block")
+		}
+		l.beginScope()
+		l.stmts(stmt.Right)
+		l.endScope()
+	case IfStmtNT:
+		l.condition(stmt.Left, stmt, false)
+		l.expr(stmt.Left)
+		l.stmt(stmt.Right)
+		if stmt.Third != nil {
+			l.stmt(stmt.Third)
+		}
+	case WhileStmtNT:
+		l.condition(stmt.Left, stmt, true)
+		l.expr(stmt.Left)
+		l.beginScope()
+		l.stmt(stmt.Right)
+		if stmt.Third != nil {
+			l.stmt(stmt.Third)
+		}
+		l.endScope()
+	case ForInStmtNT:
+		l.expr(stmt.Right)
+		l.beginScope()
+		l.declare(stmt.Left.ToString(), stmt.Left)
+		l.stmt(stmt.Third)
+		l.endScope()
+	case ExprStmtNT, PrintStmtNT, ReturnStmtNT:
+		if stmt.Right != nil {
+			l.expr(stmt.Right)
+		}
+	}
+}
+
+// function checks a function's parameters and body, for a declaration or an anonymous function
+func (l *linter) function(fun *Node) {
+	if params := int(fun.Data.(NumberValue)); l.rules.LongParameterLists && params > l.rules.MaxParams {
+		l.warn(W0406, fun, "function has %d parameters, more than %d", params, l.rules.MaxParams)
+	}
+	l.beginScope()
+	for param := fun.Right; param != nil; param = param.Next {
+		l.declare(param.ToString(), param)
+	}
+	// the body is a block, with a scope of its own, but isn't reported when it is empty
+	l.beginScope()
+	l.stmts(fun.Third.Right)
+	l.endScope()
+	l.endScope()
+}
+
+// condition reports cond if it is a constant, other than the true of an intentionally endless while loop
+func (l *linter) condition(cond *Node, stmt *Node, loop bool) {
+	if !l.rules.ConstantConditions || !isConstant(cond) {
+		return
+	}
+	if loop && cond.Type == BoolNT && cond.Data == BoolValue(true) {
+		return
+	}
+	at := cond
+	if at.Line == 0 {
+		at = stmt
+	}
+	l.warn(W0404, at, "condition is always %v", cond.truthy(Options{}))
+}
+
+// isConstant reports whether expr always has the same value, eg a literal
+func isConstant(expr *Node) bool {
+	switch expr.Type {
+	case NumberNT, StringNT, BoolNT, NilNT, LambdaNT, ArrayLiteralNT:
+		return true
+	case GroupNT:
+		return isConstant(expr.Right)
+	case UnaryNT:
+		return expr.Data.String() == "!" && isConstant(expr.Right)
+	}
+	return false
+}
+
+func (l *linter) expr(expr *Node) {
+	if expr == nil {
+		return
+	}
+	switch expr.Type {
+	case IdentifierNT:
+		l.read(expr.ToString())
+		return
+	case LambdaNT:
+		l.function(expr)
+		return
+	case AssignmentNT:
+		if l.rules.SelfAssignment && expr.Third == nil && expr.Right.Type == expr.Left.Type &&
+			(expr.Left.Type == IdentifierNT || expr.Left.Type == IndexNT) &&
+			expr.Left.ToSExpression() == expr.Right.ToSExpression() {
+			target := "element"
+			if expr.Left.Type == IdentifierNT {
+				target = "\"" + expr.Left.ToString() + "\""
+			}
+			l.warn(W0403, expr, "%s is assigned to itself", target)
+		}
+		if expr.Left.Type == IdentifierNT {
+			l.expr(expr.Right) // the target is written, not read
+			return
+		}
+	case ConditionalNT:
+		l.condition(expr.Left, expr, false)
+	case ArrayLiteralNT, CallNT:
+		for arg := expr.Right; arg != nil; arg = arg.Next {
+			l.expr(arg)
+		}
+		l.expr(expr.Left)
+		return
+	case GetNT:
+		l.expr(expr.Left) // the property name isn't a variable
+		return
+	}
+	l.expr(expr.Left)
+	l.expr(expr.Right)
+	l.expr(expr.Third)
+}
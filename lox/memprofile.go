@@ -0,0 +1,166 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// number of strings and arrays listed in the memory report
+const memReportLargest = 5
+
+// memProfile tracks how many scopes a program has open, for the memory report
+type memProfile struct {
+	liveScopes int
+	peakScopes int
+	allScopes  int
+}
+
+func (p *memProfile) openScope() {
+	p.liveScopes++
+	p.allScopes++
+	if p.liveScopes > p.peakScopes {
+		p.peakScopes = p.liveScopes
+	}
+}
+
+// EnableMemProfile starts tracking the memory used by the program run in env, to be reported with WriteMemReport
+func (env *Environment) EnableMemProfile() {
+	env.interp.memProfile = &memProfile{liveScopes: 1, peakScopes: 1, allScopes: 1} // the global scope
+}
+
+// WriteMemReport writes the peak number of scopes open at once, and the values still reachable from env by type, along
+// with the largest strings and arrays among them. Values are found by following variables in env and the scopes
+// enclosing it, then the elements of arrays, the scopes functions closed over, and the globals of modules, counting each
+// value once however many times it is referred to. Native functions aren't counted, as they aren't the program's data
+func (env *Environment) WriteMemReport(w io.Writer) {
+	p := env.interp.memProfile
+	if p == nil {
+		return
+	}
+	fmt.Fprintf(w, "Scopes: %d peak, %d created\n", p.peakScopes, p.allScopes)
+
+	r := &memReport{counts: map[string]int{}, sizes: map[string]int{}, seen: map[interface{}]bool{}}
+	r.scopes(env)
+
+	names := []string{}
+	for name := range r.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Live values:")
+	for _, name := range names {
+		fmt.Fprintf(w, "\t%-10s %6d values %8d bytes\n", name, r.counts[name], r.sizes[name])
+	}
+
+	strs := r.strs
+	sort.SliceStable(strs, func(i, j int) bool { return len(strs[i]) > len(strs[j]) })
+	if len(strs) > memReportLargest {
+		strs = strs[:memReportLargest]
+	}
+	if len(strs) > 0 {
+		fmt.Fprintln(w, "Largest strings:")
+	}
+	for _, str := range strs {
+		fmt.Fprintf(w, "\t%8d bytes %q\n", len(str), truncate(str, 40))
+	}
+
+	arrays := r.arrays
+	sort.SliceStable(arrays, func(i, j int) bool { return len(arrays[i].Elements) > len(arrays[j].Elements) })
+	if len(arrays) > memReportLargest {
+		arrays = arrays[:memReportLargest]
+	}
+	if len(arrays) > 0 {
+		fmt.Fprintln(w, "Largest arrays:")
+	}
+	for _, arr := range arrays {
+		// only the first few elements are formatted, as an array may be huge, or hold huge arrays
+		preview := &ArrayValue{Elements: arr.Elements}
+		if len(preview.Elements) > memReportLargest {
+			preview.Elements = preview.Elements[:memReportLargest]
+		}
+		fmt.Fprintf(w, "\t%8d elements %s\n", len(arr.Elements), truncate(preview.String(), 40))
+	}
+}
+
+// memReport collects the values reachable from a scope, for WriteMemReport
+type memReport struct {
+	counts map[string]int // values of each type
+	sizes  map[string]int // bytes held by the values of each type
+	strs   []string
+	arrays []*ArrayValue
+	seen   map[interface{}]bool // the nodes, arrays and scopes already visited, so each is counted once
+}
+
+// scopes visits the values in env and the scopes enclosing it
+func (r *memReport) scopes(env *Environment) {
+	for scope := env; scope != nil && !r.seen[scope]; scope = scope.Enclosing {
+		r.seen[scope] = true
+		scope.each(func(_ string, val *Node) {
+			r.value(val)
+		})
+	}
+}
+
+// value counts val, then visits the values it refers to
+func (r *memReport) value(val *Node) {
+	if val == nil || val.Type == CallableNT || r.seen[val] {
+		return
+	}
+	r.seen[val] = true
+	name := val.typeName()
+	r.counts[name]++
+	switch val.Type {
+	case FunctionNT:
+		// a function's code is part of the program, and the variables it closed over are counted as values
+		r.scopes(val.closure)
+		return
+	case ModuleNT:
+		r.scopes(val.Data.(*ModuleValue).globals)
+		return
+	case StringNT:
+		r.strs = append(r.strs, val.Data.String())
+	case ArrayNT:
+		arr := val.Data.(*ArrayValue)
+		if r.seen[arr] {
+			// another node holding an array already counted
+			r.counts[name]--
+			return
+		}
+		r.seen[arr] = true
+		r.arrays = append(r.arrays, arr)
+		for _, elem := range arr.Elements {
+			r.value(elem)
+		}
+	}
+	r.sizes[name] += dataSize(val.Data)
+}
+
+// truncate shortens s to at most n characters, marking that it was cut with "..."
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
+
+// dataSize estimates the bytes a value holds: the text of strings and decimals, and the fixed size of other values
+func dataSize(v Value) int {
+	switch v := v.(type) {
+	case NumberValue:
+		return 4
+	case BoolValue:
+		return 1
+	case StringValue:
+		return len(v)
+	case DecimalValue:
+		return len(v.Rat.String())
+	case *ArrayValue:
+		return elementSize * len(v.Elements)
+	}
+	return 0
+}
+
+// elementSize is the bytes an array holds for each of its elements, which are counted as values of their own
+const elementSize = 8
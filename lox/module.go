@@ -0,0 +1,209 @@
+package lox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleValue is a Lox file loaded by an import statement. The module's globals live in a global scope of its own, so
+// they don't clash with those of the program importing it, and are read as its properties, eg math.sqrt
+type ModuleValue struct {
+	Path    string       // the file, relative to the working directory unless found by an absolute path, or in the standard library
+	globals *Environment // the module's global scope
+	names   []string     // the globals the module declares, which can be read from outside it
+	loaded  bool         // false while the module's top-level code is still running, for detecting import cycles
+}
+
+func (m *ModuleValue) String() string {
+	return "<module " + m.Path + ">"
+}
+
+// SetScriptPath records the file the program run in env was read from, so its import statements find files relative
+// to it. Without it, imports are found relative to the working directory
+func (env *Environment) SetScriptPath(path string) {
+	env.global.path = path
+}
+
+// ModuleName is the name an import statement binds a module to when it doesn't give one with "as": the file's name
+// without its extension, eg math for "lib/math.lox". It is "" if that isn't a valid identifier
+func ModuleName(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if _, keyword := keywords[name]; keyword || name == "" {
+		return ""
+	}
+	for i, r := range name {
+		if (i == 0 && classOf(r) != alphaClass) || !isIdentifierChar(r) {
+			return ""
+		}
+	}
+	return name
+}
+
+// interpretImportStmt loads the module a file holds, the first time it is imported, and binds it to a variable
+func (env *Environment) interpretImportStmt(stmt *Node) {
+	if env.defined(stmt.Left) && !env.mayRedeclare(stmt.Left) {
+		panic(runtimeErrorf(E0403, "module \"%s\" redeclared", stmt.Left.ToString()))
+	}
+	env.define(stmt.Left, env.importModule(stmt.Right.Data.String()))
+}
+
+// findModule finds the file an import statement names: relative to the file doing the importing, then in each
+// directory of Options.ModulePath in turn, then in the standard library bundled into golox. It returns the file's
+// path, a key identifying it however it was reached, and its source
+func (env *Environment) findModule(spec string) (path string, key string, src []byte, err error) {
+	dirs := append([]string{filepath.Dir(env.global.path)}, env.interp.options.ModulePath...)
+	if filepath.IsAbs(spec) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, spec)
+		src, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", "", nil, err
+		}
+		key, err := filepath.Abs(path)
+		if err != nil {
+			key = path
+		}
+		return path, key, src, nil
+	}
+	// bundled modules are named by their path in the library, eg std/math.lox, or relative to the bundled module
+	// importing them
+	for _, name := range []string{filepath.ToSlash(filepath.Clean(spec)), filepath.ToSlash(filepath.Join(filepath.Dir(env.global.path), spec))} {
+		if src, ok := stdlib[name]; ok {
+			return name, "std:" + name, []byte(src), nil
+		}
+	}
+	return "", "", nil, fmt.Errorf("no such file relative to the importing file, in the module path, or in the standard library")
+}
+
+// importModule runs the file an import statement names in a global scope of its own, returning the module it
+// declares. Each file is run once, however many times it is imported, so the modules importing it share its globals
+func (env *Environment) importModule(spec string) *Node {
+	interp := env.interp
+	path, key, src, err := env.findModule(spec)
+	if err != nil {
+		panic(runtimeErrorf(E0420, "cannot import \"%s\": %s", spec, err))
+	}
+	if mod, ok := interp.modules[key]; ok {
+		if !mod.Data.(*ModuleValue).loaded {
+			panic(runtimeErrorf(E0421, "import cycle: %s", interp.importCycle(mod)))
+		}
+		return mod
+	}
+
+	prgm, err := parseModule(string(src))
+	if err != nil {
+		panic(runtimeErrorf(E0420, "cannot import \"%s\": %s", path, err))
+	}
+
+	global := &Environment{Values: make(map[string]*Node), path: path, interp: interp}
+	global.global = global
+	for name, val := range interp.globals.Values {
+		// natives, including those added with RegisterNative, are available in every module
+		if val.Type == CallableNT && val.Left.ToString() == name {
+			global.Values[name] = val
+		}
+	}
+	module := &ModuleValue{Path: path, globals: global}
+	for stmt := prgm.Right; stmt != nil; stmt = stmt.Next {
+		switch stmt.Type {
+		case VarDeclNT, FunDeclNT, ImportStmtNT:
+			module.names = append(module.names, stmt.Left.ToString())
+		}
+	}
+	mod := &Node{Type: ModuleNT, Data: module}
+
+	if interp.modules == nil {
+		interp.modules = map[string]*Node{}
+	}
+	interp.modules[key] = mod
+	interp.importing = append(interp.importing, mod)
+	for stmt := prgm.Right; stmt != nil; stmt = stmt.Next {
+		global.interpretStmt(stmt)
+	}
+	interp.importing = interp.importing[:len(interp.importing)-1]
+	module.loaded = true
+	return mod
+}
+
+// parseModule lexes, parses and resolves the source of an imported file
+func parseModule(src string) (*Node, error) {
+	tokens, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+	prgm, err := Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if err := Resolve(prgm); err != nil {
+		return nil, err
+	}
+	return prgm, nil
+}
+
+// importCycle describes the chain of imports leading back to mod, which is still being loaded
+func (interp *interpreter) importCycle(mod *Node) string {
+	paths := []string{}
+	for i := len(interp.importing) - 1; i >= 0; i-- {
+		paths = append([]string{interp.importing[i].Data.(*ModuleValue).Path}, paths...)
+		if interp.importing[i] == mod {
+			break
+		}
+	}
+	return strings.Join(append(paths, mod.Data.(*ModuleValue).Path), " imports ")
+}
+
+// abandonImports forgets the modules that were being loaded when a program stopped with an error, so importing them
+// again, eg in the next line of an interactive session, runs them again rather than reporting a cycle
+func (interp *interpreter) abandonImports() {
+	for _, mod := range interp.importing {
+		for key, m := range interp.modules {
+			if m == mod {
+				delete(interp.modules, key)
+			}
+		}
+	}
+	interp.importing = nil
+}
+
+// currentFile is the imported file holding the code being run, for runtime errors, or "" if it is in the program
+// itself. That's the file declaring the innermost Lox function being called, or else the module whose top-level code
+// is running
+func (interp *interpreter) currentFile() string {
+	global := interp.globals
+	if len(interp.importing) > 0 {
+		global = interp.importing[len(interp.importing)-1].Data.(*ModuleValue).globals
+	}
+	for i := len(interp.frames) - 1; i >= 0; i-- {
+		if fun := interp.frames[i]; fun.Type == FunctionNT {
+			global = fun.closure.global
+			break
+		}
+	}
+	if global == interp.globals {
+		return ""
+	}
+	return global.path
+}
+
+// moduleGet reads one of a module's globals
+func moduleGet(mod *ModuleValue, name string) *Node {
+	for _, exported := range mod.names {
+		if exported == name {
+			if val, ok := mod.globals.Values[name]; ok {
+				return val
+			}
+			break
+		}
+	}
+	panic(runtimeErrorf(E0409, "module \"%s\" has no \"%s\"%s", mod.Path, name, didYouMean(name, append([]string{}, mod.names...))))
+}
@@ -0,0 +1,215 @@
+package lox
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// nativeFn is the Go implementation of a callable built into Lox. Arguments are evaluated before being passed in
+type nativeFn func(env *Environment, args []*Node) *Node
+
+// method is a function built into a primitive type, called with the value it was accessed on as this
+type method struct {
+	arity int
+	fn    func(env *Environment, this *Node, args []*Node) *Node
+}
+
+// methods holds the built-in methods for each type of value, accessed with "." eg "hello".length()
+var methods = map[NodeType]map[string]method{
+	StringNT: {
+		"length": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			// counted in characters rather than bytes, so "héllo".length() is 5
+			return numberNode(NumberValue(utf8.RuneCountInString(string(this.Data.(StringValue)))))
+		}},
+		"upper": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return &Node{Type: StringNT, Data: StringValue(strings.ToUpper(this.Data.String()))}
+		}},
+		"lower": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return &Node{Type: StringNT, Data: StringValue(strings.ToLower(this.Data.String()))}
+		}},
+	},
+	ArrayNT: {
+		"length": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return numberNode(NumberValue(len(this.Data.(*ArrayValue).Elements)))
+		}},
+		"push": {1, func(env *Environment, this *Node, args []*Node) *Node {
+			arr := this.Data.(*ArrayValue)
+			env.interp.allocate(elementSize)
+			arr.Elements = append(arr.Elements, args[0])
+			return nilValue
+		}},
+		"pop": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			arr := this.Data.(*ArrayValue)
+			if len(arr.Elements) == 0 {
+				panic(runtimeErrorf(E0413, "cannot pop from an empty array"))
+			}
+			last := arr.Elements[len(arr.Elements)-1]
+			arr.Elements = arr.Elements[:len(arr.Elements)-1]
+			return last
+		}},
+	},
+	NumberNT: {
+		"floor": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return numberNode(NumberValue(math.Floor(float64(this.number()))))
+		}},
+		"ceil": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return numberNode(NumberValue(math.Ceil(float64(this.number()))))
+		}},
+		"round": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return numberNode(NumberValue(math.Round(float64(this.number()))))
+		}},
+		"abs": {0, func(env *Environment, this *Node, args []*Node) *Node {
+			return numberNode(NumberValue(math.Abs(float64(this.number()))))
+		}},
+	},
+}
+
+// defineNative declares a Go-backed function in env
+func (env *Environment) defineNative(name string, arity int, fn nativeFn) {
+	env.Values[name] = &Node{
+		Type:   CallableNT,
+		Data:   NumberValue(arity),
+		Left:   &Node{Type: IdentifierNT, Data: StringValue(name)},
+		native: fn,
+	}
+}
+
+// RegisterNative defines a Go function in env, so programs embedding golox can give scripts access to the host without
+// changing the built-in natives. Lox calls it with arity evaluated arguments, eg &Node{Type: NumberNT, Data:
+// NumberValue(3)}, and a nil result is Lox's nil. An error returned by fn stops the program with a RuntimeError
+func (env *Environment) RegisterNative(name string, arity int, fn func(args []*Node) (*Node, error)) {
+	env.defineNative(name, arity, func(env *Environment, args []*Node) *Node {
+		result, err := fn(args)
+		if rErr, ok := err.(*RuntimeError); ok {
+			panic(rErr)
+		}
+		if err != nil {
+			panic(runtimeErrorf(E0416, "%s(): %s", name, err))
+		}
+		if result == nil {
+			return nilValue
+		}
+		return result
+	})
+}
+
+// Call calls a Lox function value, such as one passed to a native registered with RegisterNative, from Go, returning
+// its result. A runtime error in the function, or a call to exit(), is returned as an error, as Interpret returns them
+func (env *Environment) Call(fn *Node, args ...*Node) (*Node, error) {
+	var result *Node
+	err := env.run(func() {
+		result = env.call(fn, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// interpretGet looks up a built-in method on a value, returning it as a callable bound to that value, or reads one of
+// a module's globals
+func (env *Environment) interpretGet(expr *Node) *Node {
+	obj := env.interpretExpr(expr.Left)
+	name := expr.Right.ToString()
+	if obj.Type == ModuleNT {
+		return moduleGet(obj.Data.(*ModuleValue), name)
+	}
+	m, ok := methods[obj.Type][name]
+	if !ok {
+		panic(runtimeErrorf(E0409, "\"%s\" has no property \"%s\"%s", obj.ToString(), name, didYouMean(name, methodNames(obj.Type))))
+	}
+	return &Node{
+		Type: CallableNT,
+		Data: NumberValue(m.arity),
+		Left: &Node{Type: IdentifierNT, Data: StringValue(name)},
+		native: func(env *Environment, args []*Node) *Node {
+			return m.fn(env, obj, args)
+		},
+	}
+}
+
+// isCallable reports whether n is a function value, either declared in Lox or built in
+func (n *Node) isCallable() bool {
+	return n != nil && (n.Type == FunctionNT || n.Type == CallableNT)
+}
+
+// functionName is the name a function was declared with, or "anonymous"
+func (n *Node) functionName() string {
+	if n.Type == FunctionNT {
+		if n.Third == nil {
+			return "anonymous"
+		}
+		return n.Third.ToString()
+	}
+	return n.Left.ToString()
+}
+
+func nativeArity(env *Environment, args []*Node) *Node {
+	if !args[0].isCallable() {
+		panic(runtimeErrorf(E0410, "arity() expects a function, got \"%s\"", args[0].ToString()))
+	}
+	return &Node{Type: NumberNT, Data: args[0].Data}
+}
+
+func nativeName(env *Environment, args []*Node) *Node {
+	fn := args[0]
+	if !fn.isCallable() {
+		panic(runtimeErrorf(E0410, "name() expects a function, got \"%s\"", fn.ToString()))
+	}
+	return &Node{Type: StringNT, Data: StringValue(fn.functionName())}
+}
+
+func nativeArgc(env *Environment, args []*Node) *Node {
+	return numberNode(NumberValue(len(env.interp.args)))
+}
+
+func nativeArgv(env *Environment, args []*Node) *Node {
+	if args[0].Type != NumberNT {
+		panic(runtimeErrorf(E0410, "argv() expects a number, got %s \"%s\"", args[0].typeName(), args[0].ToString()))
+	}
+	i := args[0].number()
+	if i != float32(int(i)) || i < 0 || int(i) >= len(env.interp.args) {
+		panic(runtimeErrorf(E0411, "argv() index %s out of range for %d arguments", args[0].ToString(), len(env.interp.args)))
+	}
+	return &Node{Type: StringNT, Data: StringValue(env.interp.args[int(i)])}
+}
+
+func nativeExit(env *Environment, args []*Node) *Node {
+	if args[0].Type != NumberNT {
+		panic(runtimeErrorf(E0410, "exit() expects a number, got %s \"%s\"", args[0].typeName(), args[0].ToString()))
+	}
+	// exit statuses are a byte, so other codes would be truncated or wrapped into a misleading status
+	code := args[0].number()
+	if code != float32(int(code)) || code < 0 || code > 255 {
+		panic(runtimeErrorf(E0410, "exit() expects a whole number from 0 to 255, got \"%s\"", args[0].ToString()))
+	}
+	panic(&ExitError{Code: int(code)})
+}
+
+func nativeAtExit(env *Environment, args []*Node) *Node {
+	if !args[0].isCallable() {
+		panic(runtimeErrorf(E0410, "atExit() expects a function, got %s \"%s\"", args[0].typeName(), args[0].ToString()))
+	}
+	env.interp.atExit = append(env.interp.atExit, args[0])
+	return nilValue
+}
+
+func nativeAssert(env *Environment, args []*Node) *Node {
+	if !env.interp.options.DisableAssertions && !args[0].truthy(env.interp.options) {
+		panic(runtimeErrorf(E0419, "assertion failed: %s", args[1].ToString()))
+	}
+	return nilValue
+}
+
+// callNative passes evaluated arguments to a Go-backed callable
+func (env *Environment) callNative(fun *Node, args []*Node) *Node {
+	if fun.native == nil {
+		panic(runtimeErrorf(E0412, "native function %s is not implemented", fun.Left.ToString()))
+	}
+	if arity := int(fun.number()); len(args) != arity {
+		panic(runtimeErrorf(E0405, "Expected %d arguments for %s but got %d", arity, fun.ToString(), len(args)))
+	}
+
+	return fun.native(env, args)
+}
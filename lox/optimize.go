@@ -0,0 +1,122 @@
+package lox
+
+// Optimize removes code from a parsed program that can never run: statements following a return, break or continue
+// in the same block, and the branch of an if statement whose condition is a literal, such as if (false). Each piece of
+// code removed is reported to r as a warning, W0302 or W0303. opts decides which literals are truthy, so it should
+// match the Options the program runs with. Optimize should be called before Resolve, which otherwise warns about the
+// same unreachable statements
+func Optimize(prgm *Node, opts Options, r ErrorReporter) *Node {
+	o := &optimizer{options: opts, reporter: r}
+	prgm.Right = o.stmts(prgm.Right)
+	return prgm
+}
+
+type optimizer struct {
+	options  Options
+	reporter ErrorReporter
+}
+
+// stmts optimizes a list of statements, connected by Next, dropping any after one that ends the block early
+func (o *optimizer) stmts(first *Node) *Node {
+	var head, last *Node
+	for stmt := first; stmt != nil; {
+		next := stmt.Next
+		stmt.Next = nil
+		stmt = o.stmt(stmt)
+		if last == nil {
+			head = stmt
+		} else {
+			last.Next = stmt
+		}
+		last = stmt
+
+		switch stmt.Type {
+		case ReturnStmtNT, BreakStmtNT, ContinueStmtNT:
+			if next != nil {
+				warn(o.reporter, StageOptimize, W0302, next.Line, next.Column, "unreachable code after %s removed", stmtKeywords[stmt.Type])
+				return head
+			}
+		}
+		stmt = next
+	}
+	return head
+}
+
+// stmt optimizes a single statement, returning the statement to run in its place
+func (o *optimizer) stmt(stmt *Node) *Node {
+	switch stmt.Type {
+	case DeclarationNT, StmtNT, ExprStmtNT, PrintStmtNT, ReturnStmtNT, VarDeclNT:
+		if stmt.Right != nil {
+			o.expr(stmt.Right)
+		}
+	case FunDeclNT:
+		stmt.Third = o.stmt(stmt.Third)
+	case BlockNT:
+		stmt.Right = o.stmts(stmt.Right)
+	case IfStmtNT:
+		if truthy, ok := o.constantCondition(stmt.Left); ok {
+			live, dead := stmt.Right, stmt.Third
+			if !truthy {
+				live, dead = dead, live
+			}
+			if dead != nil {
+				at := dead
+				if at.Line == 0 && at.Right != nil {
+					at = at.Right
+				}
+				if at.Line == 0 {
+					at = stmt
+				}
+				warn(o.reporter, StageOptimize, W0303, at.Line, at.Column, "code that never runs removed, as the condition is always %v", truthy)
+			}
+			if live == nil {
+				// an if statement can be the body of a loop or another if, which can't be left empty
+				return &Node{Type: BlockNT, Line: stmt.Line, Column: stmt.Column}
+			}
+			return o.stmt(live)
+		}
+		o.expr(stmt.Left)
+		stmt.Right = o.stmt(stmt.Right)
+		if stmt.Third != nil {
+			stmt.Third = o.stmt(stmt.Third)
+		}
+	case WhileStmtNT:
+		o.expr(stmt.Left)
+		stmt.Right = o.stmt(stmt.Right)
+		if stmt.Third != nil {
+			stmt.Third = o.stmt(stmt.Third)
+		}
+	case ForInStmtNT:
+		o.expr(stmt.Right)
+		stmt.Third = o.stmt(stmt.Third)
+	}
+	return stmt
+}
+
+// expr optimizes the bodies of any anonymous functions in an expression
+func (o *optimizer) expr(expr *Node) {
+	Walk(expr, func(n *Node) bool {
+		if n.Type == LambdaNT {
+			n.Third = o.stmt(n.Third)
+			return false
+		}
+		return true
+	})
+}
+
+// constantCondition reports whether cond is a literal, possibly in parentheses or negated, and if so whether it is
+// truthy. Conditions that could have side effects, such as array literals, aren't constant here
+func (o *optimizer) constantCondition(cond *Node) (truthy bool, ok bool) {
+	switch cond.Type {
+	case NumberNT, StringNT, BoolNT, NilNT:
+		return cond.truthy(o.options), true
+	case GroupNT:
+		return o.constantCondition(cond.Right)
+	case UnaryNT:
+		if cond.Data.String() == "!" {
+			truthy, ok := o.constantCondition(cond.Right)
+			return !truthy, ok
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,169 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// Options toggles non-standard extensions to the Lox language. The zero value gives the semantics described in the book,
+// except that "+" always converts numbers joined with strings, eg "count: " + 3
+type Options struct {
+	// Stringify allows "+" to concatenate a string with an operand of any other type, such as a bool or nil, converting the other operand using the same formatting as print
+	Stringify bool
+	// LooseComparison converts strings holding numbers when they are compared with numbers, so "3" == 3 and "10" > 9. Otherwise, comparing mismatched types with "<", ">", "<=" or ">=" is a runtime error
+	LooseComparison bool
+	// LooseTruthiness makes 0 and "" falsy, as well as nil and false
+	LooseTruthiness bool
+	// DisableAssertions makes the assert() native do nothing, eg for production runs of a script checked during
+	// development. Its arguments are still evaluated
+	DisableAssertions bool
+	// MaxStack is how many function calls may be in progress at once before the program stops with a stack overflow
+	// error, rather than crashing golox by running out of Go stack. 0 means DefaultMaxStack
+	MaxStack int
+	// ModulePath lists directories searched, in order, for files imported by paths that aren't found relative to the
+	// importing file, before the standard library bundled into golox
+	ModulePath []string
+}
+
+// DefaultMaxStack is the deepest recursion allowed when Options.MaxStack isn't set
+const DefaultMaxStack = 10000
+
+// maxStack is the call depth at which a stack overflow error is raised
+func (opts Options) maxStack() int {
+	if opts.MaxStack <= 0 {
+		return DefaultMaxStack
+	}
+	return opts.MaxStack
+}
+
+// interpreter holds the state shared by every scope of a running program
+type interpreter struct {
+	options Options
+	globals *Environment // the program's global scope, rather than an imported module's
+	args    []string     // command line arguments passed to the script
+	atExit  []*Node      // functions registered with atExit(), run in reverse order when the program ends
+	frames  []*Node      // functions currently being called, innermost last
+	line    int          // where the statement or expression being run is, for runtime errors
+	column  int
+	started time.Time // when the environment was created, for clock()
+
+	stdout io.Writer // where print writes
+	stderr io.Writer // where debugging output, such as PrintScope's, is written
+
+	reporter ErrorReporter // receives diagnostics as well as their errors being returned, if set
+	trace    io.Writer     // where each statement run is logged, if set
+	hooks    Hooks
+
+	memProfile *memProfile // nil unless EnableMemProfile has been called
+
+	interrupted    int32 // set by Interrupt, checked before each statement
+	interruptCause error // why the program was interrupted, if not by Interrupt
+
+	budget *stepBudget // limits how many statements run before pausing, when run by a Stepper
+
+	modules   map[string]*Node // modules imported so far, by the absolute path of their file
+	importing []*Node          // modules whose top-level code is running, innermost last
+
+	session bool // set for an interactive session, by NewSession
+
+	limits     Limits
+	statements int    // statements run so far by the current program, counted when limits are set
+	heapBase   uint64 // bytes allocated on the heap when the current program started, when MaxMemory is set
+	allocated  uint64 // bytes of strings and arrays made since memory was last checked, when MaxMemory is set
+}
+
+// Limits bounds the resources a program may use, so untrusted scripts can be run without hanging or crashing the
+// program embedding golox. A program going over a limit stops with a LimitExceededError. Zero means no limit
+type Limits struct {
+	// MaxStatements is how many statements a program may run, counting statements in loops and function bodies each
+	// time they run, as Stepper does
+	MaxStatements int
+	// MaxCallDepth is how many function calls may be in progress at once
+	MaxCallDepth int
+	// MaxMemory is how many bytes the Go heap may grow by while the program runs. It is checked every
+	// memoryCheckInterval statements, and before making a string or array once those made since the last check add up
+	// to a fraction of the limit, so values growing quickly, eg a string doubled in a loop, are stopped before they're
+	// made. It counts memory allocated by the whole process, so it is only approximate
+	MaxMemory uint64
+}
+
+// how many statements run between checks of Limits.MaxMemory, which briefly stops the world to read the heap size
+const memoryCheckInterval = 1024
+
+// the fraction of Limits.MaxMemory that strings and arrays made by a program may add up to before memory is checked
+// again, however few statements have run
+const memoryCheckFraction = 8
+
+// startLimits resets the counts Limits are checked against, when a program starts
+func (interp *interpreter) startLimits() {
+	interp.statements = 0
+	interp.allocated = 0
+	if interp.limits.MaxMemory > 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		interp.heapBase = stats.HeapAlloc
+	}
+}
+
+// checkLimits is called before each statement, stopping the program if it has run too many statements or is using
+// too much memory
+func (interp *interpreter) checkLimits() {
+	interp.statements++
+	if max := interp.limits.MaxStatements; max > 0 && interp.statements > max {
+		panic(&LimitExceededError{Limit: "MaxStatements", Message: fmt.Sprintf("ran more than %d statements", max)})
+	}
+	if interp.limits.MaxMemory > 0 && interp.statements%memoryCheckInterval == 0 {
+		interp.checkMemory(0)
+	}
+}
+
+// allocate is called before a string or array of about n bytes is made, checking memory once those made since the
+// last check add up to a fraction of Limits.MaxMemory
+func (interp *interpreter) allocate(n int) {
+	max := interp.limits.MaxMemory
+	if max == 0 {
+		return
+	}
+	interp.allocated += uint64(n)
+	if interp.allocated >= max/memoryCheckFraction {
+		interp.checkMemory(uint64(n))
+	}
+}
+
+// checkMemory stops the program if the heap has grown by more than Limits.MaxMemory, counting extra bytes about to be
+// allocated. Garbage is collected before giving up, so values the program no longer uses aren't counted against it
+func (interp *interpreter) checkMemory(extra uint64) {
+	interp.allocated = 0
+	max := interp.limits.MaxMemory
+	if extra <= max && interp.heapGrowth()+extra <= max {
+		return
+	}
+	if extra <= max {
+		runtime.GC()
+		if interp.heapGrowth()+extra <= max {
+			return
+		}
+	}
+	panic(&LimitExceededError{Limit: "MaxMemory", Message: fmt.Sprintf("used more than %d bytes of memory", max)})
+}
+
+// heapGrowth is how many bytes the heap has grown by since the current program started
+func (interp *interpreter) heapGrowth() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc < interp.heapBase {
+		return 0
+	}
+	return stats.HeapAlloc - interp.heapBase
+}
+
+// stackTrace names the functions being called, innermost first
+func (interp *interpreter) stackTrace() []string {
+	stack := []string{}
+	for i := len(interp.frames) - 1; i >= 0; i-- {
+		stack = append(stack, interp.frames[i].functionName()+"()")
+	}
+	return stack
+}
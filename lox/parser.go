@@ -1,42 +1,70 @@
 package lox
 
-import (
-	"fmt"
-)
-
 // recursive descent descends through the grammar with each token
 
 // program			-> declaration* EOF ;
-// declaration	-> funDecl | varDecl | statement ;
+// declaration	-> funDecl | varDecl | importDecl | statement ;
 // varDecl			-> "var" IDENTIFIER ( "=" expression )? ";" ;
+// importDecl		-> "import" STRING ( "as" IDENTIFIER )? ";" ;
 // funDecl			-> "fun" function ;
-// function			-> IDENTIFIER "(" parameters? ")" block ;
+// function			-> IDENTIFIER functionBody ;
+// functionBody	-> "(" parameters? ")" block ;
 // parameters		-> IDENTIFIER ( "," IDENTIFIER )* ;
-// statement		-> exprStmt | ifStmt | printStmt | forStmt | whileStmt | returnStmt | block ;
+// statement		-> exprStmt | ifStmt | printStmt | forStmt | whileStmt | returnStmt | breakStmt | continueStmt | block ;
 // block				-> "{" declaration* "}" ;
 // returnStmt 	-> "return" expression? ";" ;
-// forStmt			-> "for" "(" varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+// breakStmt		-> "break" ";" ;
+// continueStmt	-> "continue" ";" ;
+// forStmt			-> "for" "(" ( forIn | ( varDecl | exprStmt | ";" ) expression? ";" expression? ) ")" statement ;
+// forIn				-> "var" IDENTIFIER "in" expression ;
 // whileStmt		-> "while" "(" expression ")" statement ;
 // ifStmt				-> "if" "(" expression ")" statement ( "else" statement )? ;
 // exprStmt			-> expression ";" ;
 // printStmt		-> "print" expression ";" ;
 
 // expression 	-> equality ;
-// assignment		-> IDENTIFIER "=" ( assignment | logicOr ) ;
+// assignment		-> ( IDENTIFIER | call "[" expression "]" ) ( "=" | "+=" | "-=" | "*=" | "/=" | "%=" ) assignment | conditional ;
+// conditional	-> logicOr ( "?" expression ":" conditional )? ;
 // logicOr			-> logicAnd ( "or" logicAnd )* ;
 // logicAnd		-> equality ( "and" equality)* ;
 // equality 		-> comparison ( ( "!=" | "==" ) comparison )* ;
 // comparison 	-> term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
 // term					-> factor ( ( "-" | "+" ) factor )* ;
-// factor				-> unary ( ( "/" | "*" ) unary )* ;
-// unary				-> ( "!" | "-" ) unary | call ;
-// call					-> primary ( "(" arguments? ")" )* ; TODO
-// primary			-> NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" | IDENTIFIER ;
+// factor				-> unary ( ( "/" | "*" | "%" ) unary )* ;
+// unary				-> ( "!" | "-" ) unary | ( "++" | "--" ) unary | call ( "++" | "--" )? ;
+// call					-> primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" | "[" expression? ":" expression? "]" )* ;
+// primary			-> NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" | IDENTIFIER | "fun" functionBody | "[" elements? "]" ;
+// elements			-> expression ( "," expression )* ;
+
+// compoundAssignments maps each compound assignment operator to the operation it applies, so a += b is parsed as
+// a = a + b
+var compoundAssignments = map[TokenType]struct {
+	nodeType NodeType
+	operator string
+}{
+	PlusEqual:    {TermNT, "+"},
+	MinusEqual:   {TermNT, "-"},
+	StarEqual:    {FactorNT, "*"},
+	SlashEqual:   {FactorNT, "/"},
+	PercentEqual: {FactorNT, "%"},
+}
 
 // Parse takes a slice of Token and creates an Abstract Syntax Tree of Expr using the Recursive Descent method
+// When statements have errors, Parse skips them and carries on, returning every error it finds as ParseErrors
 func Parse(tokens []Token) (*Node, error) {
-	var program, declaration, funDecl, varDecl, statement, function, parameters, block, returnStmt, forStmt, whileStmt, ifStmt, exprStmt, printStmt, expression, assignment, logicOr, logicAnd, equality, comparison, term, factor, unary, call, primary func() (*Node, error)
+	return parse(tokens, nil)
+}
+
+// ParseInArena is like Parse, but allocates the AST's nodes from arena, for programs embedding golox that parse many
+// scripts
+func ParseInArena(tokens []Token, arena *Arena) (*Node, error) {
+	return parse(tokens, arena)
+}
+
+func parse(tokens []Token, arena *Arena) (*Node, error) {
+	var program, declaration, funDecl, varDecl, importDecl, statement, function, functionBody, parameters, block, returnStmt, breakStmt, continueStmt, forStmt, whileStmt, ifStmt, exprStmt, printStmt, expression, assignment, conditional, logicOr, logicAnd, equality, comparison, term, factor, unary, call, primary, elements func() (*Node, error)
 	current := 0
+	var errs ParseErrors
 
 	match := func(types ...TokenType) bool {
 		if current >= len(tokens) {
@@ -51,37 +79,137 @@ func Parse(tokens []Token) (*Node, error) {
 		return false
 	}
 
+	check := func(t TokenType) bool {
+		return current < len(tokens) && tokens[current].Type == t
+	}
+
 	previous := func() Token {
 		return tokens[current-1]
 	}
 
+	// newNode makes a node from the arena, if there is one
+	newNode := func(n Node) *Node {
+		var node *Node
+		if arena != nil {
+			node = arena.node()
+		} else {
+			node = new(Node)
+		}
+		*node = n
+		return node
+	}
+
+	// at records where tok is in the source on n, so errors found while running n can point to it
+	at := func(n *Node, tok Token) *Node {
+		n.Line, n.Column = tok.Line, tok.Column
+		return n
+	}
+
+	// comments are taken from the tokens as they are attached to statements, so each is attached once
+	comments := make([][]Comment, len(tokens))
+	for i, tok := range tokens {
+		comments[i] = tok.Comments
+	}
+
+	// attachComments moves the comments of the tokens from start up to current onto stmt: those before its first token
+	// as Leading, and those inside it, or after its last token on the same line, as Trailing. Those taken by the
+	// statements nested inside it are already gone
+	attachComments := func(stmt *Node, start int) {
+		leading, trailing := comments[start], []Comment{}
+		comments[start] = nil
+		for i := start + 1; i < current; i++ {
+			trailing = append(trailing, comments[i]...)
+			comments[i] = nil
+		}
+		if current < len(tokens) && current > 0 {
+			next, n := comments[current], 0
+			for n < len(next) && next[n].Line == previous().Line {
+				n++
+			}
+			trailing = append(trailing, next[:n]...)
+			comments[current] = next[n:]
+		}
+		if len(leading) == 0 && len(trailing) == 0 {
+			return
+		}
+		if stmt.Trivia == nil {
+			stmt.Trivia = &Trivia{}
+		}
+		stmt.Trivia.Leading = append(stmt.Trivia.Leading, leading...)
+		stmt.Trivia.Trailing = append(stmt.Trivia.Trailing, trailing...)
+	}
+
+	// closingComments moves the comments before the "}" or EOF at current onto the block or program n
+	closingComments := func(n *Node) {
+		if current < len(tokens) && len(comments[current]) > 0 {
+			n.Trivia = &Trivia{Closing: comments[current]}
+			comments[current] = nil
+		}
+	}
+
+	// synchronize skips the rest of a statement with an error in it, stopping after a semicolon or before a keyword
+	// that begins a statement, so parsing can carry on and report any later errors too
+	synchronize := func() {
+		if !check(EOF) {
+			current++
+		}
+		for current < len(tokens) && !check(EOF) {
+			if previous().Type == Semicolon {
+				return
+			}
+			switch tokens[current].Type {
+			case Class, Fun, Var, For, If, While, Print, Return, Break, Continue, Import:
+				return
+			}
+			current++
+		}
+	}
+
 	// program -> declaration* EOF ;
 	program = func() (*Node, error) {
-		stmt, err := declaration()
-		prgm := &Node{Type: ProgramNT, Right: stmt}
-		for current < len(tokens) && !match(EOF) {
+		prgm := newNode(Node{Type: ProgramNT})
+		var prev *Node
+		for current < len(tokens) && !check(EOF) {
 			decl, err := declaration()
 			if err != nil {
-				return prgm, err
+				errs = append(errs, err)
+				synchronize()
+				continue
 			}
-			if stmt != nil {
-				stmt.Next = decl
+			if prev == nil {
+				prgm.Right = decl
+			} else {
+				prev.Next = decl
 			}
-			stmt = decl
-
+			prev = decl
 		}
-		return prgm, err
+		closingComments(prgm)
+		match(EOF)
+		if len(errs) > 0 {
+			return prgm, errs
+		}
+		return prgm, nil
 	}
 
-	// declaration -> varDecl | funDecl | statement ;
+	// declaration -> varDecl | funDecl | importDecl | statement ;
 	declaration = func() (*Node, error) {
+		start, startIndex := tokens[current], current
+		var decl *Node
+		var err error
 		if match(Var) {
-			return varDecl()
+			decl, err = varDecl()
+		} else if match(Fun) {
+			decl, err = funDecl()
+		} else if match(Import) {
+			decl, err = importDecl()
+		} else {
+			decl, err = statement()
 		}
-		if match(Fun) {
-			return funDecl()
+		if decl != nil {
+			at(decl, start)
+			attachComments(decl, startIndex)
 		}
-		return statement()
+		return decl, err
 	}
 
 	// funDecl -> "fun" function ;
@@ -89,19 +217,32 @@ func Parse(tokens []Token) (*Node, error) {
 		return function()
 	}
 
-	// function -> IDENTIFIER "(" parameters? ")" block ;
+	// function -> IDENTIFIER functionBody ;
 	function = func() (*Node, error) {
-		var name Token
+		if !match(Identifier) {
+			prev := previous()
+			return nil, parseErrorf(E0201, prev, "Expected function name after token \"%s\"", prev.Lexeme)
+		}
+		name := previous()
+
+		fun, err := functionBody()
+		if err != nil {
+			return nil, err
+		}
+		fun.Type = FunDeclNT
+		fun.Left = at(newNode(Node{
+			Type: IdentifierNT,
+			Data: StringValue(name.Lexeme),
+		}), name) // name
+		return fun, nil
+	}
+
+	// functionBody -> "(" parameters? ")" block ;
+	functionBody = func() (*Node, error) {
 		var param *Node
 		var err error
 		var arity float32
-
-		if match(Identifier) {
-			name = previous()
-		} else {
-			prev := previous()
-			return nil, fmt.Errorf("Parsing error on line %d: Expected function name after token \"%s\"", prev.Line, prev.Lexeme)
-		}
+		start := previous() // the function name, or "fun" for anonymous functions
 
 		// params
 		if match(LeftParen) {
@@ -117,13 +258,13 @@ func Parse(tokens []Token) (*Node, error) {
 				arity++
 			}
 			if arity >= 255 {
-				return nil, fmt.Errorf("Parsing error on line %d: Maximum argument count (254) exceeded with %d arguments", name.Line, int(arity))
+				return nil, parseErrorf(E0202, start, "Maximum argument count (254) exceeded with %d arguments", int(arity))
 			}
 		} else {
-			return nil, fmt.Errorf("Parsing error on line %d: Expected argument list after token \"%s\"", name.Line, name.Lexeme)
+			return nil, parseErrorf(E0204, start, "Expected argument list after token \"%s\"", start.Lexeme)
 		}
 		if !match(RightParen) {
-			return nil, fmt.Errorf("Parsing error on line %d: Expected closing parenthesis after argument list", name.Line)
+			return nil, parseErrorf(E0205, start, "Expected closing parenthesis after argument list")
 		}
 
 		// body
@@ -131,36 +272,32 @@ func Parse(tokens []Token) (*Node, error) {
 		if match(LeftBrace) {
 			body, err = block()
 		} else {
-			return nil, fmt.Errorf("Parsing error on line %d: Expected function body", name.Line)
+			return nil, parseErrorf(E0206, start, "Expected function body")
 		}
 		if err != nil {
 			return nil, err
 		}
 
-		return &Node{
-			Type: FunDeclNT,
-			Data: encodeLoxNumber(arity),
-			Left: &Node{
-				Type: IdentifierNT,
-				Data: encodeString(name.Lexeme),
-			}, // name
+		return at(newNode(Node{
+			Type:  LambdaNT,
+			Data:  NumberValue(arity),
 			Right: param, // param list
 			Third: body,  // function body
-		}, err
+		}), start), nil
 	}
 
 	// parameters -> IDENTIFIER ( "," IDENTIFIER )* ;
 	parameters = func() (*Node, error) {
 		var first *Node
 		if match(Identifier) {
-			first = &Node{Type: ParamNT, Data: encodeString(previous().Lexeme)}
+			first = at(newNode(Node{Type: ParamNT, Data: StringValue(previous().Lexeme)}), previous())
 		} else {
 			return nil, nil // function takes zero parameters
 		}
 		param := first
 		for {
 			if match(Comma) && match(Identifier) {
-				param.Next = &Node{Type: ParamNT, Data: encodeString(previous().Lexeme)}
+				param.Next = at(newNode(Node{Type: ParamNT, Data: StringValue(previous().Lexeme)}), previous())
 				param = param.Next
 			} else {
 				break
@@ -172,51 +309,100 @@ func Parse(tokens []Token) (*Node, error) {
 	// varDecl -> "var" IDENTIFIER ( "=" expression )? ";" ;
 	varDecl = func() (*Node, error) {
 		ident, err := primary()
+		if err != nil {
+			return nil, err
+		}
 		var expr *Node
 		if match(Equal) {
 			expr, err = expression()
+			if err != nil {
+				return nil, err
+			}
 		}
 		if match(Semicolon) {
-			return &Node{
+			return newNode(Node{
 				Type:  VarDeclNT,
 				Left:  ident,
 				Right: expr,
-			}, err
+			}), err
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Expected semicolon after token \"%s\"", tokens[current].Line, tokens[current].Lexeme)
+		return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after token \"%s\"", tokens[current].Lexeme)
 	}
 
-	// statement -> exprStmt | ifStmt | printStmt | block | returnStmt ;
-	statement = func() (*Node, error) {
-		if match(Print) {
-			return printStmt()
+	// importDecl -> "import" STRING ( "as" IDENTIFIER )? ";" ;
+	// "as" isn't a keyword, so it can still be used as a name elsewhere
+	importDecl = func() (*Node, error) {
+		if !match(String) {
+			return nil, parseErrorf(E0217, tokens[current], "Expected the path of the file to import as a string")
 		}
-		if match(If) {
-			return ifStmt()
-		}
-		if match(While) {
-			return whileStmt()
+		pathTok := previous()
+		path := at(newNode(Node{Type: StringNT, Data: pathTok.toValue()}), pathTok)
+		var name *Node
+		if check(Identifier) && tokens[current].Lexeme == "as" {
+			current++
+			if !match(Identifier) {
+				return nil, parseErrorf(E0217, tokens[current], "Expected the module's name after \"as\"")
+			}
+			name = at(newNode(Node{Type: IdentifierNT, Data: previous().toValue()}), previous())
+		} else {
+			moduleName := ModuleName(pathTok.Lexeme)
+			if moduleName == "" {
+				return nil, parseErrorf(E0217, pathTok, "Can't name the module after the file \"%s\", so give it a name with \"as\"", pathTok.Lexeme)
+			}
+			name = at(newNode(Node{Type: IdentifierNT, Data: StringValue(moduleName)}), pathTok)
 		}
-		if match(For) {
-			return forStmt()
+		if !match(Semicolon) {
+			return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after import statement")
 		}
-		if match(LeftBrace) {
-			return block()
+		return newNode(Node{
+			Type:  ImportStmtNT,
+			Left:  name,
+			Right: path,
+		}), nil
+	}
+
+	// statement -> exprStmt | ifStmt | printStmt | block | returnStmt | breakStmt | continueStmt ;
+	statement = func() (*Node, error) {
+		start, startIndex := tokens[current], current
+		var stmt *Node
+		var err error
+		if match(Print) {
+			stmt, err = printStmt()
+		} else if match(If) {
+			stmt, err = ifStmt()
+		} else if match(While) {
+			stmt, err = whileStmt()
+		} else if match(For) {
+			stmt, err = forStmt()
+		} else if match(LeftBrace) {
+			stmt, err = block()
+		} else if match(Return) {
+			stmt, err = returnStmt()
+		} else if match(Break) {
+			stmt, err = breakStmt()
+		} else if match(Continue) {
+			stmt, err = continueStmt()
+		} else {
+			stmt, err = exprStmt()
 		}
-		if match(Return) {
-			return returnStmt()
+		if stmt != nil {
+			at(stmt, start)
+			attachComments(stmt, startIndex)
 		}
-		return exprStmt()
+		return stmt, err
 	}
 
 	// block -> "{" declaration* "}" ;
 	block = func() (*Node, error) {
 		var prev *Node
-		blk := &Node{Type: BlockNT}
-		for !match(RightBrace) {
+		blk := newNode(Node{Type: BlockNT})
+		for !check(RightBrace) && !check(EOF) {
 			decl, err := declaration()
 			if err != nil {
-				return nil, err
+				// keep parsing the rest of the block
+				errs = append(errs, err)
+				synchronize()
+				continue
 			}
 			if prev == nil {
 				blk.Right = decl
@@ -226,35 +412,80 @@ func Parse(tokens []Token) (*Node, error) {
 			prev = decl
 		}
 
-		if previous().Type == RightBrace {
+		closingComments(blk)
+		if match(RightBrace) {
 			return blk, nil
 		}
-		fmt.Println(blk.ToSExpression())
-		fmt.Println(previous().ToString())
-		return nil, fmt.Errorf("Parsing error on line %d: Expected closing brace", tokens[current].Line)
+		return nil, parseErrorf(E0207, tokens[current], "Expected closing brace")
 	}
 
 	// returnStmt -> "return" expression? ";" ;
 	returnStmt = func() (*Node, error) {
+		if match(Semicolon) {
+			// returns nil
+			return newNode(Node{Type: ReturnStmtNT}), nil
+		}
 		expr, err := expression()
 		if err != nil {
 			return nil, err
 		}
 		if match(Semicolon) {
-			return &Node{
+			return newNode(Node{
 				Type:  ReturnStmtNT,
 				Right: expr,
-			}, err
+			}), err
+		}
+		return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after return statement")
+	}
+
+	// breakStmt -> "break" ";" ;
+	breakStmt = func() (*Node, error) {
+		if match(Semicolon) {
+			return newNode(Node{Type: BreakStmtNT}), nil
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Expected semicolon after return statement", tokens[current].Line)
+		return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after break statement")
 	}
 
-	// forStmt -> "for" "(" varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+	// continueStmt -> "continue" ";" ;
+	continueStmt = func() (*Node, error) {
+		if match(Semicolon) {
+			return newNode(Node{Type: ContinueStmtNT}), nil
+		}
+		return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after continue statement")
+	}
+
+	// forStmt -> "for" "(" ( forIn | ( varDecl | exprStmt | ";" ) expression? ";" expression? ) ")" statement ;
+	// forIn -> "var" IDENTIFIER "in" expression ;
 	forStmt = func() (*Node, error) {
 		var init, cond, incr, body *Node
 		var err error
+		forTok := previous()
 		if !match(LeftParen) {
-			return nil, fmt.Errorf("Parsing error on line %d: Expected left parenthesis", tokens[current].Line)
+			return nil, parseErrorf(E0204, tokens[current], "Expected left parenthesis")
+		}
+
+		if current+2 < len(tokens) && check(Var) && tokens[current+1].Type == Identifier && tokens[current+2].Type == In {
+			// for (var x in collection)
+			current++
+			name := tokens[current]
+			current += 2
+			collection, err := expression()
+			if err != nil {
+				return nil, err
+			}
+			if !match(RightParen) {
+				return nil, parseErrorf(E0205, tokens[current], "Expected closing parenthesis in for statement")
+			}
+			body, err = statement()
+			if err != nil {
+				return nil, err
+			}
+			return newNode(Node{
+				Type:  ForInStmtNT,
+				Left:  at(newNode(Node{Type: IdentifierNT, Data: name.toValue()}), name),
+				Right: collection,
+				Third: body,
+			}), nil
 		}
 
 		// initializer
@@ -275,7 +506,7 @@ func Parse(tokens []Token) (*Node, error) {
 			return nil, err
 		}
 		if !match(Semicolon) {
-			return nil, fmt.Errorf("Parsing error on line %d: Expected semicolon in for statement", tokens[current].Line)
+			return nil, parseErrorf(E0203, tokens[current], "Expected semicolon in for statement")
 		}
 
 		// increment
@@ -284,7 +515,7 @@ func Parse(tokens []Token) (*Node, error) {
 			return nil, err
 		}
 		if !match(RightParen) {
-			return nil, fmt.Errorf("Parsing error on line %d: Expected closing parenthesis in for statement", tokens[current].Line)
+			return nil, parseErrorf(E0205, tokens[current], "Expected closing parenthesis in for statement")
 		}
 
 		// body
@@ -293,29 +524,30 @@ func Parse(tokens []Token) (*Node, error) {
 			return nil, err
 		}
 		if init == nil && cond == nil && incr == nil && body == nil {
-			return nil, fmt.Errorf("Parsing error on line %d: For loop can not be entirely empty", tokens[current].Line)
+			return nil, parseErrorf(E0208, tokens[current], "For loop can not be entirely empty")
 		}
 
-		// desugar into a while loop
-		bodyWithIncr := &Node{
-			Type:  BlockNT,
-			Right: body,
-		}
-		body.Next = incr
-
-		while := &Node{
+		// desugar into a while loop, which like the initializer is placed at the "for", for errors and traces
+		while := at(newNode(Node{
 			Type:  WhileStmtNT,
 			Left:  cond,
-			Right: bodyWithIncr,
+			Right: body,
+		}), forTok)
+		if init != nil && init.Line == 0 {
+			at(init, forTok)
+		}
+		if incr != nil {
+			// kept apart from the body, as a statement of its own, so it still runs after a continue
+			while.Third = newNode(Node{Type: ExprStmtNT, Right: incr, Line: incr.Line, Column: incr.Column})
 		}
 		if cond == nil {
-			while.Left = &Node{Type: BoolNT, Data: encodeBool(true)} // nil condition means always true
+			while.Left = newNode(Node{Type: BoolNT, Data: BoolValue(true)}) // nil condition means always true
 		}
 
-		forStmt := &Node{
+		forStmt := newNode(Node{
 			Type:  BlockNT,
 			Right: init,
-		}
+		})
 		if init == nil {
 			forStmt.Right = while
 		} else {
@@ -341,14 +573,14 @@ func Parse(tokens []Token) (*Node, error) {
 				}
 			}
 			if cond != nil && body != nil {
-				return &Node{
+				return newNode(Node{
 					Type:  WhileStmtNT,
 					Left:  cond,
 					Right: body,
-				}, err
+				}), err
 			}
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Malformed \"while\" statement", tokens[current].Line)
+		return nil, parseErrorf(E0209, tokens[current], "Malformed \"while\" statement")
 	}
 
 	// ifStmt	-> "if" "(" expression ")" statement ( "else" statement )? ;
@@ -373,37 +605,43 @@ func Parse(tokens []Token) (*Node, error) {
 				}
 			}
 			if cond != nil && thenBranch != nil {
-				n := &Node{
+				n := newNode(Node{
 					Type:  IfStmtNT,
 					Left:  cond,
 					Right: thenBranch,
-				}
+				})
 				if elseBranch != nil {
 					n.Third = elseBranch
 				}
 				return n, err
 			}
-			return nil, fmt.Errorf("Parsing error on line %d: Malformed \"if\" statement", tokens[current].Line)
+			return nil, parseErrorf(E0210, tokens[current], "Malformed \"if\" statement")
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Expected parentheses after \"if\" token", tokens[current].Line)
+		return nil, parseErrorf(E0204, tokens[current], "Expected parentheses after \"if\" token")
 	}
 
 	// exprStmt -> expression ";" ;
 	exprStmt = func() (*Node, error) {
 		expr, err := expression()
+		if err != nil {
+			return nil, err
+		}
 		if match(Semicolon) {
-			return &Node{Type: ExprStmtNT, Right: expr}, err
+			return newNode(Node{Type: ExprStmtNT, Right: expr}), err
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Expected semicolon after token \"%s\"", tokens[current].Line, tokens[current].Lexeme)
+		return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after token \"%s\"", tokens[current].Lexeme)
 	}
 
 	// printStmt -> "print" expression ";" ;
 	printStmt = func() (*Node, error) {
 		expr, err := expression()
+		if err != nil {
+			return nil, err
+		}
 		if match(Semicolon) {
-			return &Node{Type: PrintStmtNT, Right: expr}, err
+			return newNode(Node{Type: PrintStmtNT, Right: expr}), err
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Expected semicolon after token \"%s\"", tokens[current].Line, tokens[current].Lexeme)
+		return nil, parseErrorf(E0203, tokens[current], "Expected semicolon after token \"%s\"", tokens[current].Lexeme)
 	}
 
 	// expression -> assignment ;
@@ -411,42 +649,91 @@ func Parse(tokens []Token) (*Node, error) {
 		return assignment()
 	}
 
-	// assignment -> IDENTIFIER "=" ( assignment | logicOr ) ;
+	// assignment -> ( IDENTIFIER | call "[" expression "]" ) ( "=" | "+=" | "-=" | "*=" | "/=" | "%=" ) assignment | conditional ;
 	assignment = func() (*Node, error) {
-		expr, err := logicOr()
-		if match(Equal) {
+		expr, err := conditional()
+		if err != nil {
+			return nil, err
+		}
+		if match(Equal, PlusEqual, MinusEqual, StarEqual, SlashEqual, PercentEqual) {
 			operator := previous()
 			right, err := assignment()
 			if err != nil {
-				return nil, fmt.Errorf("Parsing error on line %d: Invalid r-value for assignment", tokens[current].Line)
+				return nil, err
+			}
+			if expr.Type != IdentifierNT && expr.Type != IndexNT {
+				return nil, parseErrorf(E0211, operator, "Invalid target for assignment")
 			}
-			if expr.Type == IdentifierNT {
-				return &Node{
-					Type:  AssignmentNT,
-					Left:  expr,
-					Data:  operator.toValue(),
-					Right: right,
-				}, err
+			assign := at(newNode(Node{
+				Type:  AssignmentNT,
+				Left:  expr,
+				Data:  StringValue("="),
+				Right: right,
+			}), operator)
+			if compound, ok := compoundAssignments[operator.Type]; ok {
+				op := at(newNode(Node{Type: compound.nodeType, Data: StringValue(compound.operator)}), operator)
+				if expr.Type == IndexNT {
+					// a[i] += b applies the operation as it's stored, so a and i are only evaluated once
+					assign.Third = op
+				} else {
+					// desugar a += b into a = a + b, reading the variable through a node of its own
+					op.Left, op.Right = at(newNode(Node{Type: IdentifierNT, Data: expr.Data}), operator), right
+					assign.Right = op
+				}
 			}
+			return assign, err
 		}
 		return expr, err
 	}
 
+	// conditional -> logicOr ( "?" expression ":" conditional )? ;
+	conditional = func() (*Node, error) {
+		expr, err := logicOr()
+		if err != nil {
+			return nil, err
+		}
+		if !match(Question) {
+			return expr, nil
+		}
+		operator := previous()
+		thenBranch, err := expression()
+		if err != nil {
+			return nil, err
+		}
+		if !match(Colon) {
+			return nil, parseErrorf(E0215, tokens[current], "Expected \":\" after the first branch of \"?\"")
+		}
+		// a ? b : c ? d : e groups as a ? b : (c ? d : e)
+		elseBranch, err := conditional()
+		if err != nil {
+			return nil, err
+		}
+		return at(newNode(Node{
+			Type:  ConditionalNT,
+			Left:  expr,       // condition
+			Right: thenBranch, // evaluated when the condition is truthy
+			Third: elseBranch, // evaluated otherwise
+		}), operator), nil
+	}
+
 	// logicOr	-> logicAnd ( "or" logicAnd )* ;
 	logicOr = func() (*Node, error) {
 		expr, err := logicAnd()
+		if err != nil {
+			return nil, err
+		}
 		for match(Or) {
 			operator := previous()
 			right, err := logicAnd()
 			if err != nil {
-				break
+				return nil, err
 			}
-			expr = &Node{
+			expr = at(newNode(Node{
 				Type:  LogicOrNT,
 				Left:  expr,
 				Data:  operator.toValue(),
 				Right: right,
-			}
+			}), operator)
 		}
 		return expr, err
 	}
@@ -454,18 +741,21 @@ func Parse(tokens []Token) (*Node, error) {
 	// logicAnd -> equality ( "and" equality)* ;
 	logicAnd = func() (*Node, error) {
 		expr, err := equality()
+		if err != nil {
+			return nil, err
+		}
 		for match(And) {
 			operator := previous()
 			right, err := equality()
 			if err != nil {
-				break
+				return nil, err
 			}
-			expr = &Node{
+			expr = at(newNode(Node{
 				Type:  LogicAndNT,
 				Left:  expr,
 				Data:  operator.toValue(),
 				Right: right,
-			}
+			}), operator)
 		}
 		return expr, err
 	}
@@ -473,18 +763,21 @@ func Parse(tokens []Token) (*Node, error) {
 	// equality -> comparison ( ( "!=" | "==" ) comparison )* ;
 	equality = func() (*Node, error) {
 		expr, err := comparison()
+		if err != nil {
+			return nil, err
+		}
 		for match(BangEqual, EqualEqual) {
 			operator := previous()
 			right, err := comparison()
 			if err != nil {
-				break
+				return nil, err
 			}
-			expr = &Node{
+			expr = at(newNode(Node{
 				Type:  EqualityNT,
 				Left:  expr,
 				Data:  operator.toValue(),
 				Right: right,
-			}
+			}), operator)
 		}
 		return expr, err
 	}
@@ -492,18 +785,21 @@ func Parse(tokens []Token) (*Node, error) {
 	// comparison -> term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
 	comparison = func() (*Node, error) {
 		expr, err := term()
+		if err != nil {
+			return nil, err
+		}
 		for match(Greater, GreaterEqual, Less, LessEqual) {
 			operator := previous()
 			right, err := term()
 			if err != nil {
-				break
+				return nil, err
 			}
-			expr = &Node{
+			expr = at(newNode(Node{
 				Type:  ComparisonNT,
 				Left:  expr,
 				Data:  operator.toValue(),
 				Right: right,
-			}
+			}), operator)
 		}
 		return expr, err
 	}
@@ -511,74 +807,161 @@ func Parse(tokens []Token) (*Node, error) {
 	// term	-> factor ( ( "-" | "+" ) factor )* ;
 	term = func() (*Node, error) {
 		expr, err := factor()
+		if err != nil {
+			return nil, err
+		}
 		for match(Minus, Plus) {
 			operator := previous()
 			right, err := factor()
 			if err != nil {
-				break
+				return nil, err
 			}
-			expr = &Node{
+			expr = at(newNode(Node{
 				Type:  TermNT,
 				Left:  expr,
 				Data:  operator.toValue(),
 				Right: right,
-			}
+			}), operator)
 		}
 		return expr, err
 	}
 
-	// factor	-> unary ( ( "/" | "*" ) unary )* ;
+	// factor	-> unary ( ( "/" | "*" | "%" ) unary )* ;
 	factor = func() (*Node, error) {
 		expr, err := unary()
-		for match(Slash, Star) {
+		if err != nil {
+			return nil, err
+		}
+		for match(Slash, Star, Percent) {
 			operator := previous()
 			right, err := unary()
 			if err != nil {
-				break
+				return nil, err
 			}
-			expr = &Node{
+			expr = at(newNode(Node{
 				Type:  FactorNT,
 				Left:  expr,
 				Data:  operator.toValue(),
 				Right: right,
-			}
+			}), operator)
 		}
 		return expr, err
 	}
 
-	// unary -> ( "!" | "-" ) unary | call ;
+	// increment makes the node for ++ or -- applied to target, which holds the operand as Right when the operator comes
+	// before it, as for unary operators, and as Left when it comes after
+	increment := func(target *Node, operator Token, prefix bool) (*Node, error) {
+		if target.Type != IdentifierNT && target.Type != IndexNT {
+			return nil, parseErrorf(E0211, operator, "Invalid target for \"%s\"", operator.Lexeme)
+		}
+		n := newNode(Node{Type: IncrementNT, Data: operator.toValue()})
+		if prefix {
+			n.Right = target
+		} else {
+			n.Left = target
+		}
+		return at(n, operator), nil
+	}
+
+	// unary -> ( "!" | "-" ) unary | ( "++" | "--" ) unary | call ( "++" | "--" )? ;
 	unary = func() (*Node, error) {
+		if match(PlusPlus, MinusMinus) {
+			operator := previous()
+			target, err := unary()
+			if err != nil {
+				return nil, err
+			}
+			return increment(target, operator, true)
+		}
 		if match(Bang, Minus) {
 			operator := previous()
 			right, err := unary()
-			return &Node{
+			if err != nil {
+				return nil, err
+			}
+			return at(newNode(Node{
 				Type:  UnaryNT,
 				Data:  operator.toValue(),
 				Right: right,
-			}, err
+			}), operator), err
+		}
+		expr, err := call()
+		if err != nil {
+			return nil, err
 		}
-		return call()
+		if match(PlusPlus, MinusMinus) {
+			return increment(expr, previous(), false)
+		}
+		return expr, nil
 	}
 
 	var finishCall func() (*Node, float32, error)
-	// call -> primary ( "(" arguments? ")" )* ;
+	// call -> primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" | "[" expression? ":" expression? "]" )* ;
 	call = func() (*Node, error) {
 		expr, err := primary()
+		if err != nil {
+			return nil, err
+		}
 		for {
 			if match(LeftParen) {
+				paren := previous()
 				arg, arity, err := finishCall()
 				if err != nil {
 					return nil, err
 				}
-				expr = &Node{
+				expr = at(newNode(Node{
 					Type:  CallNT,
-					Data:  encodeLoxNumber(arity),
-					Left:  expr, // just IdentifierNT now. CallableNT as wrapper later, for object methods
-					Right: arg,  // arg list (ArgNT?), tied together through Next
-				}
+					Data:  NumberValue(arity),
+					Left:  expr, // callee, any expression evaluating to a function
+					Right: arg,  // arg list, tied together through Next
+				}), paren)
 				if !match(RightParen) {
-					return nil, fmt.Errorf("Parsing error on line %d: Expected closing parenthesis after argument list", previous().Line)
+					return nil, parseErrorf(E0205, previous(), "Expected closing parenthesis after argument list")
+				}
+			} else if match(Dot) {
+				if !match(Identifier) {
+					return nil, parseErrorf(E0212, previous(), "Expected property name after \".\"")
 				}
+				name := previous()
+				expr = at(newNode(Node{
+					Type:  GetNT,
+					Left:  expr,                                                              // object
+					Right: at(newNode(Node{Type: IdentifierNT, Data: name.toValue()}), name), // property name
+				}), name)
+			} else if match(LeftBracket) {
+				bracket := previous()
+				var index, end *Node
+				if !check(Colon) {
+					if index, err = expression(); err != nil {
+						return nil, err
+					}
+				}
+				if match(Colon) {
+					// a slice, whose start and end may both be left out
+					if !check(RightBracket) {
+						if end, err = expression(); err != nil {
+							return nil, err
+						}
+					}
+					if !match(RightBracket) {
+						return nil, parseErrorf(E0216, tokens[current], "Expected \"]\" after slice")
+					}
+					expr = at(newNode(Node{
+						Type:  SliceNT,
+						Left:  expr,  // array or string
+						Right: index, // start, or nil
+						Third: end,   // end, or nil
+					}), bracket)
+					continue
+				}
+				if !match(RightBracket) {
+					return nil, parseErrorf(E0216, tokens[current], "Expected \"]\" after index")
+				}
+				expr = at(newNode(Node{
+					Type:  IndexNT,
+					Left:  expr,  // array or string
+					Right: index, // index
+				}), bracket)
 			} else {
 				break
 			}
@@ -592,6 +975,9 @@ func Parse(tokens []Token) (*Node, error) {
 		var err error
 		var count float32
 
+		if check(RightParen) {
+			return nil, count, nil // call takes zero arguments
+		}
 		first, err = expression()
 		if err != nil {
 			return nil, count, err
@@ -618,38 +1004,85 @@ func Parse(tokens []Token) (*Node, error) {
 		}
 
 		if count >= 255 {
-			return nil, count, fmt.Errorf("Parsing error: Maximum argument count (254) exceeded with %f arguments", count)
+			return nil, count, parseErrorf(E0202, previous(), "Maximum argument count (254) exceeded with %d arguments", int(count))
 		}
 		return first, count, err
 	}
 
-	// primary -> IDENTIFIER | NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" ;
+	// primary -> IDENTIFIER | NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" | "fun" functionBody | "[" elements? "]" ;
 	primary = func() (*Node, error) {
 		if match(Identifier) {
-			return &Node{Type: IdentifierNT, Data: previous().toValue()}, nil
+			return at(newNode(Node{Type: IdentifierNT, Data: previous().toValue()}), previous()), nil
 		}
 		if match(Number) {
-			return &Node{Type: NumberNT, Data: previous().toValue()}, nil
+			return at(newNode(Node{Type: NumberNT, Data: previous().toValue()}), previous()), nil
 		}
 		if match(String) {
-			return &Node{Type: StringNT, Data: previous().toValue()}, nil
+			return at(newNode(Node{Type: StringNT, Data: previous().toValue()}), previous()), nil
 		}
 		if match(True, False) {
-			return &Node{Type: BoolNT, Data: previous().toValue()}, nil
+			return at(newNode(Node{Type: BoolNT, Data: previous().toValue()}), previous()), nil
 		}
 		if match(Nil) {
-			return &Node{Type: NilNT, Data: previous().toValue()}, nil
+			return at(newNode(Node{Type: NilNT, Data: previous().toValue()}), previous()), nil
+		}
+		if match(Fun) {
+			// anonymous function
+			return functionBody()
+		}
+		if match(LeftBracket) {
+			bracket := previous()
+			elems, err := elements()
+			if err != nil {
+				return nil, err
+			}
+			if !match(RightBracket) {
+				return nil, parseErrorf(E0216, tokens[current], "Expected \"]\" after array elements")
+			}
+			return at(newNode(Node{
+				Type:  ArrayLiteralNT,
+				Right: elems, // element expressions, tied together through Next
+			}), bracket), nil
+		}
+		if match(This) {
+			// there are no classes yet, so there is never an instance for "this" to refer to
+			return nil, parseErrorf(E0214, previous(), "Can't use \"this\" outside of a class method")
 		}
 		if match(LeftParen) {
+			paren := previous()
 			expr, err := expression()
+			if err != nil {
+				return nil, err
+			}
 			if match(RightParen) {
-				return &Node{
+				return at(newNode(Node{
 					Type:  GroupNT,
-					Right: expr}, err
+					Right: expr}), paren), err
 			}
-			return nil, fmt.Errorf("Parsing error on line %d: Expected closing parenthesis following token \"%s\"", tokens[current].Line, tokens[current].Lexeme)
+			return nil, parseErrorf(E0205, tokens[current], "Expected closing parenthesis following token \"%s\"", tokens[current].Lexeme)
+		}
+		return nil, parseErrorf(E0213, tokens[current], "Unexpected token \"%s\"", tokens[current].Lexeme)
+	}
+
+	// elements -> expression ( "," expression )* ;
+	elements = func() (*Node, error) {
+		if check(RightBracket) {
+			return nil, nil // empty array
+		}
+		first, err := expression()
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("Parsing error on line %d: Unexpected token \"%s\"", tokens[current].Line, tokens[current].Lexeme)
+		last := first
+		for match(Comma) {
+			elem, err := expression()
+			if err != nil {
+				return nil, err
+			}
+			last.Next = elem
+			last = elem
+		}
+		return first, nil
 	}
 
 	return program()
@@ -0,0 +1,108 @@
+package lox
+
+import "fmt"
+
+// Severity is how serious a Diagnostic is
+type Severity int
+
+const (
+	// SeverityError stops the program, or stops it from running at all
+	SeverityError Severity = iota
+	// SeverityWarning points out something likely to be a mistake, without stopping the program
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Stages of running a program, where a Diagnostic can come from
+const (
+	StageLex      = "lex"
+	StageParse    = "parse"
+	StageResolve  = "resolve"
+	StageLint     = "lint"
+	StageOptimize = "optimize"
+	StageRun      = "run"
+)
+
+// Diagnostic describes a problem found in a program, so programs embedding golox can collect, filter or format
+// problems without picking apart each error type. Line and Column are 0 when the problem's position isn't known
+type Diagnostic struct {
+	Severity Severity
+	Stage    string // one of the Stage constants
+	Code     Code   // "" for errors without a code, such as an interruption
+	Line     int
+	Column   int
+	Message  string
+	Err      error // the error or *Warning the diagnostic describes, eg for FormatError
+}
+
+// ErrorReporter receives the diagnostics for a program as they are found. Set one with Interpreter.SetReporter or
+// Environment.SetReporter
+type ErrorReporter interface {
+	Report(diag Diagnostic)
+}
+
+// Diagnose describes an error returned by Lex, Parse, Resolve, Interpret or Eval as diagnostics. ParseErrors gives one
+// diagnostic for each error, a call to exit() gives none, and other errors give one each
+func Diagnose(err error) []Diagnostic {
+	switch e := err.(type) {
+	case nil, *ExitError:
+		return nil
+	case ParseErrors:
+		diags := []Diagnostic{}
+		for _, err := range e {
+			diags = append(diags, Diagnose(err)...)
+		}
+		return diags
+	case *LexError:
+		return []Diagnostic{{Stage: StageLex, Code: e.Code, Line: e.Line, Column: e.Column, Message: e.Message, Err: e}}
+	case *ParseError:
+		return []Diagnostic{{Stage: StageParse, Code: e.Code, Line: e.Line, Column: e.Column, Message: e.Message, Err: e}}
+	case *ResolveError:
+		return []Diagnostic{{Stage: StageResolve, Code: e.Code, Line: e.Line, Column: e.Column, Message: e.Message, Err: e}}
+	case *RuntimeError:
+		return []Diagnostic{{Stage: StageRun, Code: e.Code, Line: e.Line, Column: e.Column, Message: e.Message, Err: e}}
+	case *InterruptError, *LimitExceededError:
+		return []Diagnostic{{Stage: StageRun, Message: e.Error(), Err: e}}
+	}
+	// eg an S-expression that couldn't be read, in place of parsing
+	return []Diagnostic{{Stage: StageParse, Message: err.Error(), Err: err}}
+}
+
+// SetReporter sends diagnostics for the programs run in env to r as well as returning errors as usual. Errors and
+// warnings from lexing, parsing and resolving are only reported when they are called through an Interpreter
+func (env *Environment) SetReporter(r ErrorReporter) {
+	env.interp.reporter = r
+}
+
+// warn reports a warning found at the given stage to r, if it isn't nil
+func warn(r ErrorReporter, stage string, code Code, line int, column int, format string, a ...interface{}) {
+	if r == nil {
+		return
+	}
+	w := &Warning{Code: code, Line: line, Column: column, Message: fmt.Sprintf(format, a...)}
+	r.Report(Diagnostic{
+		Severity: SeverityWarning,
+		Stage:    stage,
+		Code:     code,
+		Line:     line,
+		Column:   column,
+		Message:  w.Message,
+		Err:      w,
+	})
+}
+
+// report sends the diagnostics for err to the reporter, if there is one
+func (env *Environment) report(err error) {
+	if env.interp.reporter == nil {
+		return
+	}
+	for _, diag := range Diagnose(err) {
+		env.interp.reporter.Report(diag)
+	}
+}
@@ -0,0 +1,291 @@
+package lox
+
+import (
+	"fmt"
+	"sort"
+)
+
+// resolver tracks the local scopes surrounding the node being resolved. Each scope maps a name to whether its
+// declaration has finished, so a variable read in its own initializer can be reported
+type resolver struct {
+	scopes    []map[string]bool
+	slots     []map[string]int   // for each scope, the slot each of its variables is stored in
+	unused    []map[string]*Node // for each scope, the variables declared in it that haven't been read, for warnings
+	reporter  ErrorReporter      // receives warnings, if set
+	functions int                // how many function bodies the resolver is inside
+	loops     int                // how many loops the resolver is inside, within the innermost function
+	line      int                // line of the statement being resolved
+}
+
+// Resolve walks a parsed program, binding each variable to the scope it was declared in, so the interpreter can find
+// it without searching every enclosing scope, and a function sees the variables around its declaration rather than
+// ones declared later. It also reports return statements outside functions, and local variables read in their own
+// initializers, local variables and parameters declared twice in the same scope, and break and continue statements outside
+// loops. Programs can be interpreted without being resolved, looking variables up by name as they run
+func Resolve(prgm *Node) error {
+	return ResolveReporting(prgm, nil)
+}
+
+// ResolveReporting is like Resolve, but sends warnings to r about local variables that are never read, and statements
+// after a return, break or continue that can never run
+func ResolveReporting(prgm *Node, reporter ErrorReporter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*ResolveError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	r := &resolver{reporter: reporter}
+	r.resolveStmts(prgm.Right)
+	return nil
+}
+
+// errorf makes an error pointing at n, eg a parameter declared twice or the keyword of a misplaced return statement.
+// If the AST doesn't record where n is, the error is on the line of the statement being resolved
+func (r *resolver) errorf(n *Node, code Code, format string, a ...interface{}) *ResolveError {
+	err := &ResolveError{Code: code, Line: r.line, Message: fmt.Sprintf(format, a...)}
+	if n.Line != 0 {
+		err.Line, err.Column = n.Line, n.Column
+	}
+	switch n.Type {
+	case IdentifierNT, ParamNT:
+		err.Lexeme = n.ToString()
+	case ImportStmtNT:
+		err.Lexeme = "import"
+	default:
+		err.Lexeme = stmtKeywords[n.Type]
+	}
+	return err
+}
+
+// resolveStmts resolves a list of statements, connected by Next
+func (r *resolver) resolveStmts(stmt *Node) {
+	warned := false
+	for ; stmt != nil; stmt = stmt.Next {
+		r.resolveStmt(stmt)
+		switch stmt.Type {
+		case ReturnStmtNT, BreakStmtNT, ContinueStmtNT:
+			if next := stmt.Next; next != nil && !warned {
+				warn(r.reporter, StageResolve, W0302, next.Line, next.Column, "unreachable code after %s", stmtKeywords[stmt.Type])
+				warned = true
+			}
+		}
+	}
+}
+
+// stmtKeywords are the keywords starting statements that end a block early, for warnings about the code after them
+var stmtKeywords = map[NodeType]string{ReturnStmtNT: "return", BreakStmtNT: "break", ContinueStmtNT: "continue"}
+
+// resolveStmt resolves a single statement, and not the ones following it
+func (r *resolver) resolveStmt(stmt *Node) {
+	if stmt == nil {
+		return
+	}
+	if stmt.Line != 0 {
+		r.line = stmt.Line
+	}
+	switch stmt.Type {
+	case DeclarationNT, StmtNT, ExprStmtNT, PrintStmtNT:
+		r.resolveStmt(stmt.Right)
+	case VarDeclNT:
+		r.declare(stmt.Left)
+		r.resolveExpr(stmt.Right)
+		r.define(stmt.Left.ToString())
+		if len(r.unused) > 0 {
+			r.unused[len(r.unused)-1][stmt.Left.ToString()] = stmt
+		}
+	case ImportStmtNT:
+		if len(r.scopes) > 0 {
+			panic(r.errorf(stmt, E0305, "Can't import \"%s\" outside the top level of a file", stmt.Right.ToString()))
+		}
+		r.declare(stmt.Left)
+		r.define(stmt.Left.ToString())
+	case FunDeclNT:
+		// defined before the body is resolved, so the function can call itself
+		r.declare(stmt.Left)
+		r.define(stmt.Left.ToString())
+		r.resolveFunction(stmt)
+	case BlockNT:
+		r.beginScope()
+		r.resolveStmts(stmt.Right)
+		r.endScope(stmt)
+	case IfStmtNT:
+		r.resolveExpr(stmt.Left)
+		r.resolveStmt(stmt.Right)
+		r.resolveStmt(stmt.Third)
+	case WhileStmtNT:
+		// the interpreter runs each loop in a scope of its own
+		r.beginScope()
+		r.resolveExpr(stmt.Left)
+		r.loops++
+		r.resolveStmt(stmt.Right)
+		r.loops--
+		r.resolveStmt(stmt.Third)
+		r.endScope(stmt)
+	case ForInStmtNT:
+		// the collection is evaluated once, before the loop's scope is created
+		r.resolveExpr(stmt.Right)
+		r.beginScope()
+		r.declare(stmt.Left)
+		r.define(stmt.Left.ToString())
+		r.loops++
+		r.resolveStmt(stmt.Third)
+		r.loops--
+		r.endScope(stmt)
+	case ReturnStmtNT:
+		if r.functions == 0 {
+			panic(r.errorf(stmt, E0301, "Can't return from outside a function"))
+		}
+		r.resolveExpr(stmt.Right)
+	case BreakStmtNT:
+		if r.loops == 0 {
+			panic(r.errorf(stmt, E0303, "Can't break from outside a loop"))
+		}
+	case ContinueStmtNT:
+		if r.loops == 0 {
+			panic(r.errorf(stmt, E0304, "Can't continue outside a loop"))
+		}
+	default:
+		r.resolveExpr(stmt)
+	}
+}
+
+// resolveFunction resolves a function's parameters, in a scope of their own around the body's block, as they are
+// when the function is called
+func (r *resolver) resolveFunction(decl *Node) {
+	// a loop around the function doesn't contain its body, which can't break out of the loop
+	loops := r.loops
+	r.loops = 0
+	r.functions++
+	r.beginScope()
+	for param := decl.Right; param != nil; param = param.Next {
+		if _, ok := r.scopes[len(r.scopes)-1][param.ToString()]; ok {
+			panic(r.errorf(param, E0306, "Duplicate parameter \"%s\"", param.ToString()))
+		}
+		r.declare(param)
+		r.define(param.ToString())
+	}
+	r.resolveStmt(decl.Third)
+	r.endScope(decl)
+	r.functions--
+	r.loops = loops
+}
+
+func (r *resolver) resolveExpr(expr *Node) {
+	if expr == nil {
+		return
+	}
+	switch expr.Type {
+	case IdentifierNT:
+		name := expr.ToString()
+		if len(r.scopes) > 0 {
+			if defined, ok := r.scopes[len(r.scopes)-1][name]; ok && !defined {
+				panic(r.errorf(expr, E0302, "Can't read local variable \"%s\" in its own initializer", name))
+			}
+		}
+		r.resolveLocal(expr)
+		if expr.depth != globalDepth {
+			delete(r.unused[len(r.unused)-1-expr.depth], name)
+		}
+	case AssignmentNT:
+		r.resolveExpr(expr.Right)
+		if expr.Left.Type == IndexNT {
+			r.resolveExpr(expr.Left)
+		} else {
+			r.resolveLocal(expr.Left)
+		}
+	case CallNT:
+		r.resolveExpr(expr.Left)
+		for arg := expr.Right; arg != nil; arg = arg.Next {
+			r.resolveExpr(arg)
+		}
+	case LambdaNT:
+		r.resolveFunction(expr)
+	case ArrayLiteralNT:
+		for elem := expr.Right; elem != nil; elem = elem.Next {
+			r.resolveExpr(elem)
+		}
+	case ConditionalNT, SliceNT:
+		r.resolveExpr(expr.Left)
+		r.resolveExpr(expr.Right)
+		r.resolveExpr(expr.Third)
+	case GetNT:
+		// the property name isn't a variable
+		r.resolveExpr(expr.Left)
+	default:
+		r.resolveExpr(expr.Left)
+		r.resolveExpr(expr.Right)
+	}
+}
+
+// resolveLocal records how many scopes out from ident its variable was declared, and the slot it is stored in there.
+// Variables not declared in any local scope are globals
+func (r *resolver) resolveLocal(ident *Node) {
+	ident.resolved = true
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][ident.ToString()]; ok {
+			ident.depth = len(r.scopes) - 1 - i
+			ident.slot = r.slots[i][ident.ToString()]
+			return
+		}
+	}
+	ident.depth = globalDepth
+}
+
+func (r *resolver) beginScope() {
+	r.scopes = append(r.scopes, make(map[string]bool))
+	r.slots = append(r.slots, make(map[string]int))
+	r.unused = append(r.unused, make(map[string]*Node))
+}
+
+// endScope closes the innermost scope, recording the names of its slots on owner, the node creating the scope when it
+// runs, and warning about any variables declared in it that were never read
+func (r *resolver) endScope(owner *Node) {
+	slots := r.slots[len(r.slots)-1]
+	owner.locals = make([]string, len(slots))
+	for name, slot := range slots {
+		owner.locals[slot] = name
+	}
+
+	unused := []*Node{}
+	for _, decl := range r.unused[len(r.unused)-1] {
+		unused = append(unused, decl)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		a, b := unused[i], unused[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	for _, decl := range unused {
+		warn(r.reporter, StageResolve, W0301, decl.Line, decl.Column, "local variable \"%s\" is never used", decl.Left.ToString())
+	}
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	r.slots = r.slots[:len(r.slots)-1]
+	r.unused = r.unused[:len(r.unused)-1]
+}
+
+// declare adds the variable ident names to the innermost scope, giving it the next free slot there. A local variable
+// can't be declared twice in the same scope. Globals aren't given slots, and redeclaring one is reported when the
+// program runs instead, as an interactive session may redeclare them
+func (r *resolver) declare(ident *Node) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	name := ident.ToString()
+	if _, ok := r.scopes[len(r.scopes)-1][name]; ok {
+		panic(r.errorf(ident, E0306, "\"%s\" is already declared in this scope", name))
+	}
+	r.scopes[len(r.scopes)-1][name] = false
+	slots := r.slots[len(r.slots)-1]
+	slot := len(slots)
+	slots[name] = slot
+	ident.resolved, ident.depth, ident.slot = true, 0, slot
+}
+
+func (r *resolver) define(name string) {
+	if len(r.scopes) > 0 {
+		r.scopes[len(r.scopes)-1][name] = true
+	}
+}
@@ -0,0 +1,212 @@
+package lox
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// S-expressions write each node as (Type value left right third), eg (Term + (Number 1) (Number 2)). The value is left
+// out when a node has no data, missing children before a present one are written as _, and statements following one
+// another are joined with "->". Values holding spaces, parentheses or quotes are quoted like Go strings
+
+// ToSExpression converts an AST into parenthesized S-expressions, which FromSExpression can read back
+func (n *Node) ToSExpression() string {
+	if n == nil {
+		return "_"
+	}
+	s := "(" + n.Type.String()
+	if n.Data != nil {
+		s += " " + formatSExpressionValue(n.sExpressionValue())
+	}
+
+	children := []*Node{n.Left, n.Right, n.Third}
+	for len(children) > 0 && children[len(children)-1] == nil {
+		children = children[:len(children)-1]
+	}
+	for _, child := range children {
+		s += " " + child.ToSExpression()
+	}
+	s += ")"
+
+	if n.Next == nil {
+		return s
+	}
+	return s + "\n -> " + n.Next.ToSExpression()
+}
+
+// sExpressionValue is the readable form of a node's data
+func (n *Node) sExpressionValue() string {
+	if d, ok := n.Data.(DecimalValue); ok {
+		// decimals are kept as fractions, since rounding them when printed would lose information
+		return d.Rat.String()
+	}
+	return n.Data.String()
+}
+
+func formatSExpressionValue(v string) string {
+	if v == "" || strings.HasPrefix(v, "_") || strings.ContainsAny(v, " \t\r\n()\"") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// FromSExpression reads an AST written by ToSExpression, so trees can be saved, edited by hand, and loaded again
+// without going through the lexer and parser
+func FromSExpression(src string) (*Node, error) {
+	r := &sExpressionReader{src: src}
+	n, err := r.readChain()
+	if err != nil {
+		return nil, err
+	}
+	if r.skipSpace(); r.pos < len(r.src) {
+		return nil, r.errorf("unexpected \"%s\" after end of expression", r.src[r.pos:r.pos+1])
+	}
+	return n, nil
+}
+
+type sExpressionReader struct {
+	src string
+	pos int
+}
+
+func (r *sExpressionReader) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("S-expression error at offset %d: %s", r.pos, fmt.Sprintf(format, a...))
+}
+
+func (r *sExpressionReader) skipSpace() {
+	for r.pos < len(r.src) && strings.IndexByte(" \t\r\n", r.src[r.pos]) >= 0 {
+		r.pos++
+	}
+}
+
+// readChain reads a node, or _ for nil, along with any nodes following it after "->"
+func (r *sExpressionReader) readChain() (*Node, error) {
+	r.skipSpace()
+	if strings.HasPrefix(r.src[r.pos:], "_") {
+		r.pos++
+		return nil, nil
+	}
+	n, err := r.readNode()
+	if err != nil {
+		return nil, err
+	}
+	r.skipSpace()
+	if strings.HasPrefix(r.src[r.pos:], "->") {
+		r.pos += 2
+		if n.Next, err = r.readChain(); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// readNode reads a single parenthesized node
+func (r *sExpressionReader) readNode() (*Node, error) {
+	if r.pos >= len(r.src) || r.src[r.pos] != '(' {
+		return nil, r.errorf("expected \"(\"")
+	}
+	r.pos++
+	name := r.readAtom()
+	n := &Node{Type: nodeTypeNamed(name)}
+	if n.Type == EOFNT && name != "EOF" {
+		return nil, r.errorf("unknown node type \"%s\"", name)
+	}
+
+	r.skipSpace()
+	if r.pos < len(r.src) && r.src[r.pos] != '(' && r.src[r.pos] != ')' && r.src[r.pos] != '_' {
+		var value string
+		var err error
+		if r.src[r.pos] == '"' {
+			value, err = r.readQuoted()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = r.readAtom()
+		}
+		if n.Data, err = parseSExpressionValue(n.Type, value); err != nil {
+			return nil, r.errorf("%s", err)
+		}
+	}
+
+	for _, child := range []**Node{&n.Left, &n.Right, &n.Third} {
+		r.skipSpace()
+		if r.pos < len(r.src) && r.src[r.pos] == ')' {
+			break
+		}
+		var err error
+		if *child, err = r.readChain(); err != nil {
+			return nil, err
+		}
+	}
+
+	r.skipSpace()
+	if r.pos >= len(r.src) || r.src[r.pos] != ')' {
+		return nil, r.errorf("expected \")\" to close %s", name)
+	}
+	r.pos++
+	return n, nil
+}
+
+// readAtom reads up to the next space or parenthesis
+func (r *sExpressionReader) readAtom() string {
+	start := r.pos
+	for r.pos < len(r.src) && strings.IndexByte(" \t\r\n()", r.src[r.pos]) < 0 {
+		r.pos++
+	}
+	return r.src[start:r.pos]
+}
+
+func (r *sExpressionReader) readQuoted() (string, error) {
+	start := r.pos
+	for r.pos++; r.pos < len(r.src) && r.src[r.pos] != '"'; r.pos++ {
+		if r.src[r.pos] == '\\' {
+			r.pos++
+		}
+	}
+	if r.pos >= len(r.src) {
+		return "", r.errorf("unterminated string")
+	}
+	r.pos++
+	v, err := strconv.Unquote(r.src[start:r.pos])
+	if err != nil {
+		return "", r.errorf("invalid string %s", r.src[start:r.pos])
+	}
+	return v, nil
+}
+
+// parseSExpressionValue converts the readable form of a value back into node data of the given type
+func parseSExpressionValue(t NodeType, v string) (Value, error) {
+	switch t {
+	case NumberNT, FunDeclNT, LambdaNT, FunctionNT, CallableNT, CallNT:
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number \"%s\"", v)
+		}
+		return NumberValue(f), nil
+	case DecimalNT:
+		r, ok := new(big.Rat).SetString(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid decimal \"%s\"", v)
+		}
+		return DecimalValue{r}, nil
+	case BoolNT:
+		if v != "true" && v != "false" {
+			return nil, fmt.Errorf("invalid bool \"%s\"", v)
+		}
+		return BoolValue(v == "true"), nil
+	}
+	return StringValue(v), nil
+}
+
+// nodeTypeNamed is the NodeType with the given name, or EOFNT if there is none
+func nodeTypeNamed(name string) NodeType {
+	for t, n := range nodeTypeNames {
+		if n == name {
+			return t
+		}
+	}
+	return EOFNT
+}
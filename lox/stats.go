@@ -0,0 +1,54 @@
+package lox
+
+// Stats summarizes the size and shape of a program
+type Stats struct {
+	Tokens      int
+	TokenCounts map[TokenType]int
+	Nodes       int
+	NodeCounts  map[NodeType]int
+	MaxDepth    int // deepest nesting of nodes, not counting statements following one another
+	Functions   []FunctionStats
+}
+
+// FunctionStats describes a function declared in a program
+type FunctionStats struct {
+	Name   string
+	Params int
+	Nodes  int // number of nodes in the declaration, including the body
+}
+
+// ComputeStats counts the tokens of a program and the nodes of its AST
+func ComputeStats(tokens []Token, program *Node) Stats {
+	stats := Stats{
+		Tokens:      len(tokens),
+		TokenCounts: make(map[TokenType]int),
+		NodeCounts:  make(map[NodeType]int),
+	}
+	for _, t := range tokens {
+		stats.TokenCounts[t.Type]++
+	}
+	stats.Nodes = stats.countNodes(program, 1)
+	return stats
+}
+
+// countNodes walks the AST below n, returning the number of nodes in it
+func (stats *Stats) countNodes(n *Node, depth int) int {
+	count := 0
+	for ; n != nil; n = n.Next {
+		count++
+		stats.NodeCounts[n.Type]++
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		size := stats.countNodes(n.Left, depth+1) + stats.countNodes(n.Right, depth+1) + stats.countNodes(n.Third, depth+1)
+		if n.Type == FunDeclNT {
+			stats.Functions = append(stats.Functions, FunctionStats{
+				Name:   n.Left.ToString(),
+				Params: int(n.number()),
+				Nodes:  size,
+			})
+		}
+		count += size
+	}
+	return count
+}
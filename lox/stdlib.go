@@ -0,0 +1,156 @@
+package lox
+
+// stdlib is the standard library bundled into golox, imported like any other module, eg import "std/math.lox";. A
+// directory in Options.ModulePath with a file of the same path takes its place. Numbers in Lox are 32-bit floats, so
+// the results of the math module are only as precise as they allow. The modules are kept in Go source rather than
+// embedded from .lox files with go:embed, which needs Go 1.16, newer than golox requires
+var stdlib = map[string]string{
+	"std/math.lox": `// Numeric functions beyond Lox's operators and number methods
+var pi = 3.14159265;
+var e = 2.71828183;
+
+fun abs(x) {
+  return x < 0 ? -x : x;
+}
+
+fun min(a, b) {
+  return a < b ? a : b;
+}
+
+fun max(a, b) {
+  return a > b ? a : b;
+}
+
+// clamp limits x to the range from low to high
+fun clamp(x, low, high) {
+  return min(max(x, low), high);
+}
+
+// sqrt finds the square root of x by Newton's method
+fun sqrt(x) {
+  assert(x >= 0, "sqrt() of a negative number");
+  if (x == 0) return 0;
+  var guess = x > 1 ? x / 2 : 1;
+  for (var i = 0; i < 32; i++) {
+    var next = (guess + x / guess) / 2;
+    if (next == guess) break;
+    guess = next;
+  }
+  return guess;
+}
+
+// pow raises x to a whole number power, which may be negative
+fun pow(x, n) {
+  assert(n == n.floor(), "pow() takes a whole number power");
+  if (n < 0) return 1 / pow(x, -n);
+  var result = 1;
+  while (n > 0) {
+    if (n % 2 == 1) result = result * x;
+    x = x * x;
+    n = (n / 2).floor();
+  }
+  return result;
+}
+
+// gcd is the greatest common divisor of two whole numbers
+fun gcd(a, b) {
+  a = abs(a);
+  b = abs(b);
+  while (b != 0) {
+    var rest = a % b;
+    a = b;
+    b = rest;
+  }
+  return a;
+}
+`,
+
+	"std/strings.lox": `// String functions beyond the string natives and methods
+
+fun repeat(s, n) {
+  var out = "";
+  for (var i = 0; i < n; i++) out += s;
+  return out;
+}
+
+// padLeft adds pad to the start of s until it is at least width characters long
+fun padLeft(s, width, pad) {
+  while (len(s) < width) s = pad + s;
+  return s;
+}
+
+// padRight adds pad to the end of s until it is at least width characters long
+fun padRight(s, width, pad) {
+  while (len(s) < width) s = s + pad;
+  return s;
+}
+
+// join joins the elements of an array into one string, with sep between them
+fun join(parts, sep) {
+  var out = "";
+  for (var i = 0; i < len(parts); i++) {
+    if (i > 0) out += sep;
+    out += parts[i];
+  }
+  return out;
+}
+
+fun contains(s, sub) {
+  return indexOf(s, sub) >= 0;
+}
+
+fun startsWith(s, prefix) {
+  return len(prefix) <= len(s) and s[:len(prefix)] == prefix;
+}
+
+fun endsWith(s, suffix) {
+  return len(suffix) <= len(s) and s[len(s) - len(suffix):] == suffix;
+}
+
+fun reverse(s) {
+  var out = "";
+  for (var c in s) out = c + out;
+  return out;
+}
+`,
+
+	"std/arrays.lox": `// Array functions. Those returning an array make a new one, leaving the array passed in unchanged
+
+// range makes an array of the whole numbers from start up to, but not including, end
+fun range(start, end) {
+  var out = [];
+  for (var i = start; i < end; i++) out.push(i);
+  return out;
+}
+
+fun map(a, fn) {
+  var out = [];
+  for (var x in a) out.push(fn(x));
+  return out;
+}
+
+fun filter(a, fn) {
+  var out = [];
+  for (var x in a) if (fn(x)) out.push(x);
+  return out;
+}
+
+// reduce combines the elements of an array with fn, starting from initial, eg reduce(a, add, 0) for their sum
+fun reduce(a, fn, initial) {
+  var acc = initial;
+  for (var x in a) acc = fn(acc, x);
+  return acc;
+}
+
+fun contains(a, value) {
+  for (var x in a) if (x == value) return true;
+  return false;
+}
+
+fun reverse(a) {
+  var out = [];
+  for (var i = len(a) - 1; i >= 0; i--) out.push(a[i]);
+  return out;
+}
+`,
+}
@@ -0,0 +1,90 @@
+package lox
+
+import "math"
+
+// Stepper runs a program a limited number of statements at a time, so programs embedding golox, like game engines and
+// UIs, can interleave a script with their own work, eg running a few hundred statements each frame
+type Stepper struct {
+	prgm     *Node
+	global   *Environment
+	budget   *stepBudget
+	finished chan error
+
+	started bool
+	done    bool
+	err     error
+}
+
+// stepBudget hands control back and forth between the goroutine running the program and the one calling Step, so
+// only one of them runs at a time
+type stepBudget struct {
+	remaining int
+	resume    chan int      // more statements the program may run
+	paused    chan struct{} // signalled when the program has used up its statements
+}
+
+// take is called before each statement, blocking until Step allows more statements when none are left
+func (b *stepBudget) take() {
+	if b.remaining == 0 {
+		b.paused <- struct{}{}
+		b.remaining = <-b.resume
+	}
+	b.remaining--
+}
+
+// NewStepper prepares prgm to be run by calling Step, with global declarations stored in global. global shouldn't be
+// used to run anything else while the program is in progress
+func (prgm *Node) NewStepper(global *Environment) *Stepper {
+	budget := &stepBudget{resume: make(chan int), paused: make(chan struct{})}
+	global.interp.budget = budget
+	return &Stepper{
+		prgm:     prgm,
+		global:   global,
+		budget:   budget,
+		finished: make(chan error, 1),
+	}
+}
+
+// Step runs the program until it has executed n more statements, or until it finishes. Statements nested in blocks,
+// loops, and function bodies each count, as do functions registered with atExit(). Once the program is done, err is
+// whatever Interpret would have returned
+func (s *Stepper) Step(n int) (done bool, err error) {
+	if s.done || n <= 0 {
+		return s.done, s.err
+	}
+	if !s.started {
+		s.started = true
+		go func() {
+			s.budget.remaining = <-s.budget.resume
+			s.finished <- s.prgm.Interpret(s.global)
+		}()
+	}
+
+	s.budget.resume <- n
+	select {
+	case <-s.budget.paused:
+		return false, nil
+	case s.err = <-s.finished:
+		s.done = true
+		s.global.interp.budget = nil
+		return true, s.err
+	}
+}
+
+// Stop interrupts a program that hasn't finished, so the goroutine running it can exit. Step then reports it as done
+// with an InterruptError
+func (s *Stepper) Stop() {
+	if s.done {
+		return
+	}
+	if !s.started {
+		s.done = true
+		s.err = &InterruptError{}
+		s.global.interp.budget = nil
+		return
+	}
+	s.global.Interrupt()
+	for done := false; !done; {
+		done, _ = s.Step(math.MaxInt32)
+	}
+}
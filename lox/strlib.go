@@ -0,0 +1,74 @@
+package lox
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// stringArg is the i-th argument of the native fn, which must be a string
+func stringArg(fn string, args []*Node, i int) string {
+	if args[i].Type != StringNT {
+		panic(runtimeErrorf(E0410, "%s() expects a string, got %s \"%s\"", fn, args[i].typeName(), args[i].ToString()))
+	}
+	return args[i].Data.String()
+}
+
+// numberArg is the i-th argument of the native fn, which must be a number
+func numberArg(fn string, args []*Node, i int) float32 {
+	if args[i].Type != NumberNT {
+		panic(runtimeErrorf(E0410, "%s() expects a number, got %s \"%s\"", fn, args[i].typeName(), args[i].ToString()))
+	}
+	return args[i].number()
+}
+
+// nativeSubstr returns length characters of a string starting from start, or as many as there are
+func nativeSubstr(env *Environment, args []*Node) *Node {
+	chars := []rune(stringArg("substr", args, 0))
+	numberArg("substr", args, 1) // so a start of the wrong type is reported as an argument to substr()
+	start := checkIndex(args[1], len(chars), true)
+	length := numberArg("substr", args, 2)
+	if length != float32(int(length)) || length < 0 {
+		panic(runtimeErrorf(E0410, "substr() expects a length of 0 or more, got \"%s\"", args[2].ToString()))
+	}
+	end := start + int(length)
+	if end > len(chars) {
+		end = len(chars)
+	}
+	return &Node{Type: StringNT, Data: StringValue(chars[start:end])}
+}
+
+// nativeIndexOf returns the index of the first character of the first occurrence of a substring, or -1 if there is
+// none. Like indexing, it counts characters rather than bytes
+func nativeIndexOf(env *Environment, args []*Node) *Node {
+	str, sub := stringArg("indexOf", args, 0), stringArg("indexOf", args, 1)
+	i := strings.Index(str, sub)
+	if i >= 0 {
+		i = utf8.RuneCountInString(str[:i])
+	}
+	return numberNode(NumberValue(i))
+}
+
+// nativeSplit returns an array of the parts of a string between each occurrence of a separator. An empty separator
+// splits the string into characters
+func nativeSplit(env *Environment, args []*Node) *Node {
+	parts := strings.Split(stringArg("split", args, 0), stringArg("split", args, 1))
+	arr := &ArrayValue{Elements: make([]*Node, len(parts))}
+	env.interp.allocate(elementSize*len(arr.Elements) + len(args[0].Data.String()))
+	for i, part := range parts {
+		arr.Elements[i] = &Node{Type: StringNT, Data: StringValue(part)}
+	}
+	return &Node{Type: ArrayNT, Data: arr}
+}
+
+func nativeUpper(env *Environment, args []*Node) *Node {
+	return &Node{Type: StringNT, Data: StringValue(strings.ToUpper(stringArg("upper", args, 0)))}
+}
+
+func nativeLower(env *Environment, args []*Node) *Node {
+	return &Node{Type: StringNT, Data: StringValue(strings.ToLower(stringArg("lower", args, 0)))}
+}
+
+// nativeTrim removes whitespace from both ends of a string
+func nativeTrim(env *Environment, args []*Node) *Node {
+	return &Node{Type: StringNT, Data: StringValue(strings.TrimSpace(stringArg("trim", args, 0)))}
+}
@@ -0,0 +1,78 @@
+package lox
+
+import "sort"
+
+// names further than this many edits from what was written aren't suggested
+const maxSuggestionDistance = 2
+
+// visibleNames lists the identifiers defined in env and every scope enclosing it, including natives
+func (env *Environment) visibleNames() []string {
+	names := []string{}
+	for scope := env; scope != nil; scope = scope.Enclosing {
+		scope.each(func(name string, _ *Node) {
+			names = append(names, name)
+		})
+	}
+	return names
+}
+
+// methodNames lists the built-in methods of a type of value
+func methodNames(t NodeType) []string {
+	names := []string{}
+	for name := range methods[t] {
+		names = append(names, name)
+	}
+	return names
+}
+
+// didYouMean suggests the candidate closest to a name that wasn't found, to be appended to an error message eg
+// "; did you mean "length"?". It returns "" when nothing is close enough
+func didYouMean(name string, candidates []string) string {
+	// sorted so ties are broken the same way every run
+	sort.Strings(candidates)
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, c := range candidates {
+		if d := editDistance(name, c); d < bestDistance && d < len(name) {
+			best, bestDistance = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return "; did you mean \"" + best + "\"?"
+}
+
+// editDistance is the Damerau-Levenshtein distance between a and b: the number of characters inserted, deleted,
+// substituted, or swapped with their neighbour to turn one into the other
+func editDistance(a string, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min(n int, rest ...int) int {
+	for _, m := range rest {
+		if m < n {
+			n = m
+		}
+	}
+	return n
+}
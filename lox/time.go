@@ -0,0 +1,42 @@
+package lox
+
+import (
+	"math/big"
+	"sync/atomic"
+	"time"
+)
+
+// how often sleep() checks whether the program has been interrupted
+const sleepInterruptCheck = 10 * time.Millisecond
+
+// nativeClock returns the seconds since the environment was created. Numbers are too imprecise to hold the time since
+// the epoch in seconds, so clock() is for measuring how long parts of a program take
+func nativeClock(env *Environment, args []*Node) *Node {
+	return numberNode(NumberValue(time.Since(env.interp.started).Seconds()))
+}
+
+// nativeNow returns the milliseconds since the Unix epoch, as a decimal since numbers can't hold them exactly
+func nativeNow(env *Environment, args []*Node) *Node {
+	ms := time.Now().UnixNano() / int64(time.Millisecond)
+	return &Node{Type: DecimalNT, Data: DecimalValue{new(big.Rat).SetInt64(ms)}}
+}
+
+// nativeSleep pauses the program for a number of milliseconds. The pause ends early if the program is interrupted,
+// stopping the program there, so a sleep() at the end of a program can't swallow the interruption
+func nativeSleep(env *Environment, args []*Node) *Node {
+	ms := numberArg("sleep", args, 0)
+	if ms < 0 {
+		panic(runtimeErrorf(E0410, "sleep() expects 0 or more milliseconds, got \"%s\"", args[0].ToString()))
+	}
+	deadline := time.Now().Add(time.Duration(float64(ms) * float64(time.Millisecond)))
+	for left := time.Until(deadline); left > 0; left = time.Until(deadline) {
+		if atomic.CompareAndSwapInt32(&env.interp.interrupted, 1, 0) {
+			panic(&InterruptError{Cause: env.interp.interruptCause})
+		}
+		if left > sleepInterruptCheck {
+			left = sleepInterruptCheck
+		}
+		time.Sleep(left)
+	}
+	return nilValue
+}
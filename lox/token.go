@@ -12,6 +12,8 @@ const (
 	RightParen
 	LeftBrace
 	RightBrace
+	LeftBracket
+	RightBracket
 	Comma
 	Dot
 	Minus
@@ -19,6 +21,9 @@ const (
 	Semicolon
 	Slash
 	Star
+	Percent
+	Question
+	Colon
 
 	// 1-2 characters
 	Bang
@@ -29,6 +34,13 @@ const (
 	GreaterEqual
 	Less
 	LessEqual
+	PlusEqual
+	MinusEqual
+	StarEqual
+	SlashEqual
+	PercentEqual
+	PlusPlus
+	MinusMinus
 
 	// Literals
 	Identifier
@@ -37,12 +49,16 @@ const (
 
 	// Keywords
 	And
+	Break
 	Class
+	Continue
 	Else
 	False
 	Fun
 	For
 	If
+	Import
+	In
 	Nil
 	Or
 	Print
@@ -56,16 +72,90 @@ const (
 	EOF
 )
 
-// Token represents a token as produced by the lexer. Lexeme stores the string value of the token, and line the line number of the original file where the token is located
+var tokenTypeNames = map[TokenType]string{
+	LeftParen:    "LeftParen",
+	RightParen:   "RightParen",
+	LeftBrace:    "LeftBrace",
+	RightBrace:   "RightBrace",
+	LeftBracket:  "LeftBracket",
+	RightBracket: "RightBracket",
+	Comma:        "Comma",
+	Dot:          "Dot",
+	Minus:        "Minus",
+	Plus:         "Plus",
+	Semicolon:    "Semicolon",
+	Slash:        "Slash",
+	Star:         "Star",
+	Percent:      "Percent",
+	Question:     "Question",
+	Colon:        "Colon",
+	Bang:         "Bang",
+	BangEqual:    "BangEqual",
+	Equal:        "Equal",
+	EqualEqual:   "EqualEqual",
+	Greater:      "Greater",
+	GreaterEqual: "GreaterEqual",
+	Less:         "Less",
+	LessEqual:    "LessEqual",
+	PlusEqual:    "PlusEqual",
+	MinusEqual:   "MinusEqual",
+	StarEqual:    "StarEqual",
+	SlashEqual:   "SlashEqual",
+	PercentEqual: "PercentEqual",
+	PlusPlus:     "PlusPlus",
+	MinusMinus:   "MinusMinus",
+	Identifier:   "Identifier",
+	String:       "String",
+	Number:       "Number",
+	And:          "And",
+	Break:        "Break",
+	Class:        "Class",
+	Continue:     "Continue",
+	Else:         "Else",
+	False:        "False",
+	Fun:          "Fun",
+	For:          "For",
+	If:           "If",
+	Import:       "Import",
+	In:           "In",
+	Nil:          "Nil",
+	Or:           "Or",
+	Print:        "Print",
+	Return:       "Return",
+	Super:        "Super",
+	This:         "This",
+	True:         "True",
+	Var:          "Var",
+	While:        "While",
+	EOF:          "EOF",
+}
+
+// String names the TokenType, eg "LeftParen"
+func (t TokenType) String() string {
+	if name, ok := tokenTypeNames[t]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// Token represents a token as produced by the lexer. Lexeme stores the string value of the token, and Line and Column where it starts in the original file, counting from 1
+// Columns count characters, so a multi-byte UTF-8 character only moves the next token along by one. Start and Length
+// are the byte offset of the token in the source, counting from 0, and the number of bytes it spans, so tools can find
+// its exact text. A string's span includes its quotes, which its Lexeme doesn't
 type Token struct {
 	Type   TokenType
 	Lexeme string
 	Line   int
+	Column int
+	Start  int
+	Length int
+
+	Comments []Comment // between the previous token and this one
 }
 
 // NewToken creates a new token of the given type
 func NewToken(typ TokenType, lexeme string, line int) *Token {
-	return &Token{typ, lexeme, line}
+	return &Token{Type: typ, Lexeme: lexeme, Line: line}
 }
 
 // ToString represents a token as a string
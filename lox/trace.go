@@ -0,0 +1,55 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SetTrace writes a line to w for each statement run in env, giving its line and kind, followed by the value it
+// produced, if any: the value of an expression statement, a variable's initial value, or the value returned. Lines
+// are indented by how many function calls are in progress. Pass nil to stop tracing
+func (env *Environment) SetTrace(w io.Writer) {
+	env.interp.trace = w
+}
+
+// traceStmt runs stmt as execStmt does, tracing it
+func (env *Environment) traceStmt(stmt *Node) *Node {
+	switch stmt.Type {
+	case DeclarationNT, StmtNT, BlockNT:
+		return env.execStmt(stmt) // only the statements inside are traced
+	}
+
+	prefix := fmt.Sprintf("%s[line %d] ", strings.Repeat("  ", len(env.interp.frames)), stmt.Line)
+	if stmt.Type == ReturnStmtNT && len(env.interp.frames) == 0 {
+		// a program's last expression statement, run as a return to capture its value
+		fmt.Fprintln(env.interp.trace, prefix+ExprStmtNT.String())
+		val := env.execStmt(stmt)
+		fmt.Fprintln(env.interp.trace, prefix+"=> "+val.ToString())
+		return val
+	}
+	desc := stmt.Type.String()
+	switch stmt.Type {
+	case VarDeclNT, FunDeclNT, ForInStmtNT, ImportStmtNT:
+		desc += " " + stmt.Left.ToString()
+	}
+	fmt.Fprintln(env.interp.trace, prefix+desc)
+
+	switch stmt.Type {
+	case ExprStmtNT:
+		// evaluated here rather than by execStmt, which discards the value
+		val := env.interpretExpr(stmt.Right)
+		fmt.Fprintln(env.interp.trace, prefix+"=> "+val.ToString())
+		return nil
+	case VarDeclNT:
+		env.execStmt(stmt)
+		val, _ := env.get(stmt.Left)
+		fmt.Fprintf(env.interp.trace, "%s%s = %s\n", prefix, stmt.Left.ToString(), val.ToString())
+		return nil
+	case ReturnStmtNT:
+		val := env.execStmt(stmt)
+		fmt.Fprintln(env.interp.trace, prefix+"return "+val.ToString())
+		return val
+	}
+	return env.execStmt(stmt)
+}
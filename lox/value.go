@@ -0,0 +1,120 @@
+package lox
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Value is the data held by a Node: what a literal or runtime value holds, or the name, operator, or arity of other
+// kinds of node. It is one of NumberValue, StringValue, BoolValue, DecimalValue or *ArrayValue, and String gives the
+// form print shows
+type Value interface {
+	String() string
+}
+
+// NumberValue is a Lox number
+type NumberValue float32
+
+// StringValue is a Lox string, or the text of an identifier, operator, or other token
+type StringValue string
+
+// BoolValue is true or false
+type BoolValue bool
+
+// DecimalValue is an exact decimal, created with the decimal() native. Rat is never modified once the value is
+// created, so values can share it
+type DecimalValue struct {
+	Rat *big.Rat
+}
+
+// ArrayValue holds the elements of a Lox array. Arrays are shared rather than copied, so every variable holding an
+// array sees changes made to its elements through any of them
+type ArrayValue struct {
+	Elements []*Node
+}
+
+// Nodes for values the interpreter produces often, shared rather than allocated for each result, eg of a comparison
+// in a loop. Nodes holding runtime values are never changed once made, so programs embedding golox mustn't change the
+// nodes it returns or passes to natives either
+var (
+	nilValue   = &Node{Type: NilNT}
+	trueValue  = &Node{Type: BoolNT, Data: BoolValue(true)}
+	falseValue = &Node{Type: BoolNT, Data: BoolValue(false)}
+	// whole numbers from 0 to len(smallNumbers)-1, eg loop counters and array indexes
+	smallNumbers [1024]*Node
+)
+
+func init() {
+	for i := range smallNumbers {
+		smallNumbers[i] = &Node{Type: NumberNT, Data: NumberValue(i)}
+	}
+}
+
+// boolNode is the node holding b
+func boolNode(b bool) *Node {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+// numberNode is a node holding n, shared for small whole numbers
+func numberNode(n NumberValue) *Node {
+	if n >= 0 && n < NumberValue(len(smallNumbers)) && n == NumberValue(int(n)) && !math.Signbit(float64(n)) {
+		return smallNumbers[int(n)]
+	}
+	return &Node{Type: NumberNT, Data: n}
+}
+
+func (v NumberValue) String() string {
+	return formatNumber(float32(v))
+}
+
+func (v StringValue) String() string {
+	return string(v)
+}
+
+func (v BoolValue) String() string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
+
+func (v DecimalValue) String() string {
+	return formatDecimal(v.Rat)
+}
+
+// String writes the elements between brackets, with strings quoted so ["a, b"] can be told apart from ["a", "b"]
+func (v *ArrayValue) String() string {
+	return v.format(map[*ArrayValue]bool{})
+}
+
+// format writes an array, printing arrays that contain themselves as [...] rather than recursing forever
+func (v *ArrayValue) format(seen map[*ArrayValue]bool) string {
+	if seen[v] {
+		return "[...]"
+	}
+	seen[v] = true
+	defer delete(seen, v)
+
+	elems := make([]string, len(v.Elements))
+	for i, el := range v.Elements {
+		switch el.Type {
+		case StringNT:
+			elems[i] = strconv.Quote(el.Data.String())
+		case ArrayNT:
+			elems[i] = el.Data.(*ArrayValue).format(seen)
+		default:
+			elems[i] = el.ToString()
+		}
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// number is the value of a NumberNT, or the arity or argument count of functions and calls
+func (n *Node) number() float32 {
+	return float32(n.Data.(NumberValue))
+}
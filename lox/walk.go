@@ -0,0 +1,69 @@
+package lox
+
+// Walk traverses an AST depth first, in the order its nodes appear in the source: it calls fn(n), then walks n's Left,
+// Right and Third children, each followed by the nodes after it through Next, such as the statements of a block or the
+// arguments of a call. When fn returns false, the node's children are skipped. Nodes following n itself aren't walked,
+// so walking a ProgramNT covers the whole program
+func Walk(n *Node, fn func(*Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	for _, child := range []*Node{n.Left, n.Right, n.Third} {
+		for ; child != nil; child = child.Next {
+			Walk(child, fn)
+		}
+	}
+}
+
+// Rewrite transforms an AST from the bottom up, replacing each node with what fn returns for it once its children have
+// been rewritten. fn may return the node, changed or not, a new node, or nil to remove it. A node in a chain, such as
+// a statement in a block, can be replaced by several by returning them joined through Next. fn is passed each node
+// without the nodes following it, which are rewritten separately and joined on afterwards. Rewrite returns the new
+// root, followed by the nodes that followed n, which aren't rewritten
+func Rewrite(n *Node, fn func(*Node) *Node) *Node {
+	if n == nil {
+		return nil
+	}
+	next := n.Next
+	n.Next = nil
+	n.Left = rewriteChain(n.Left, fn)
+	n.Right = rewriteChain(n.Right, fn)
+	n.Third = rewriteChain(n.Third, fn)
+	return joinChains(fn(n), next)
+}
+
+// rewriteChain rewrites each node in a chain joined by Next, returning the new chain
+func rewriteChain(first *Node, fn func(*Node) *Node) *Node {
+	var head *Node
+	for n := first; n != nil; {
+		next := n.Next
+		n.Next = nil
+		head = joinChains(head, Rewrite(n, fn))
+		n = next
+	}
+	return head
+}
+
+// joinChains appends the chain starting at b to the one starting at a
+func joinChains(a, b *Node) *Node {
+	if a == nil {
+		return b
+	}
+	last := a
+	for last.Next != nil {
+		last = last.Next
+	}
+	last.Next = b
+	return a
+}
+
+// IsStatement reports whether n is a statement rather than an expression or a part of one, eg for tools finding the
+// lines of a program that run. Blocks, including those the parser makes for for loops, are statements too
+func (n *Node) IsStatement() bool {
+	switch n.Type {
+	case VarDeclNT, FunDeclNT, BlockNT, ReturnStmtNT, BreakStmtNT, ContinueStmtNT, ExprStmtNT, PrintStmtNT, WhileStmtNT,
+		ForInStmtNT, IfStmtNT, ImportStmtNT:
+		return true
+	}
+	return false
+}
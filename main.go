@@ -1,72 +1,754 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/jheredos/golox/lox"
 )
 
+var options lox.Options
+
+// Exit statuses, following the sysexits.h convention used by Crafting Interpreters, so scripts and tests can tell
+// failures apart. A test run with differences exits with 1
+const (
+	exitUsage    = 64 // the command line was wrong
+	exitDataErr  = 65 // the script has lexing, parsing or resolving errors
+	exitNoInput  = 66 // the script couldn't be read
+	exitSoftware = 70 // the script stopped with a runtime error
+)
+
+// memProfile reports memory use when the program finishes, and pprofPath is where to write a heap profile, if set
+var memProfile bool
+var pprofPath string
+
+// dumpTokens prints the script's tokens, and dumpAST its parse tree, instead of running it
+var dumpTokens bool
+var dumpAST bool
+
+// trace logs each statement as it runs, to stderr
+var trace bool
+
+// profile reports the time spent in each function and on each line when a script finishes
+var profile bool
+
+// cover reports which lines of a script ran, and coverPath is where to write the coverage of each line, if set
+var cover bool
+var coverPath string
+
+// optimize removes code that can never run from scripts before they run
+var optimize bool
+
+// assertions enables the assert() native, on unless turned off with -ea=false
+var assertions bool
+
+// modulePath lists directories searched for imported files, separated like PATH, before those in LOX_PATH
+var modulePath string
+
+// werror treats warnings as errors, stopping scripts with warnings before they run
+var werror bool
+
+// inlineSource is a program given on the command line with -e, to run instead of a script
+var inlineSource string
+
+// timeout limits how long a program may run, if nonzero
+var timeout time.Duration
+
+// running is the global environment of the program currently being interpreted, which is interrupted on Ctrl+C
+var running struct {
+	sync.Mutex
+	env *lox.Environment
+}
+
+func setRunning(env *lox.Environment) {
+	running.Lock()
+	running.env = env
+	running.Unlock()
+}
+
+// handleInterrupts stops the running program on Ctrl+C instead of killing golox, or starts a fresh prompt if the REPL is waiting for input
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			running.Lock()
+			if running.env != nil {
+				running.env.Interrupt()
+			} else {
+				fmt.Print("\n> ")
+			}
+			running.Unlock()
+		}
+	}()
+}
+
 func main() {
-	if len(os.Args) > 2 {
-		fmt.Println("Usage: golox [script]")
-		os.Exit(1)
-	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
+	flag.BoolVar(&options.Stringify, "stringify", false, "allow \"+\" to concatenate strings with values of other types")
+	flag.BoolVar(&options.LooseComparison, "loose", false, "convert numeric strings to numbers when comparing them with numbers")
+	flag.BoolVar(&options.LooseTruthiness, "loose-truthiness", false, "treat 0 and \"\" as falsy")
+	flag.DurationVar(&timeout, "timeout", 0, "stop the program if it runs longer than this, eg 5s")
+	flag.BoolVar(&assertions, "ea", true, "enable assert(); -ea=false turns assertions off, eg for production runs")
+	flag.IntVar(&options.MaxStack, "max-stack", lox.DefaultMaxStack, "how many function calls may be in progress at once")
+	flag.BoolVar(&memProfile, "memprofile", false, "report scopes, live values, and the largest strings when the program finishes")
+	flag.StringVar(&pprofPath, "pprof", "", "with --memprofile, also write a pprof heap profile to this file")
+	flag.BoolVar(&dumpTokens, "tokens", false, "print the script's tokens, one per line, instead of running it")
+	flag.StringVar(&inlineSource, "e", "", "run this source instead of a script, printing the value of its last expression")
+	flag.BoolVar(&trace, "trace", false, "log each statement to stderr as it runs, with the values it produces")
+	flag.BoolVar(&cover, "cover", false, "report to stderr which lines of the script ran when it finishes")
+	flag.StringVar(&coverPath, "coverout", "", "with --cover, also write each line's coverage to this file: LCOV if it ends in .info or .lcov, otherwise annotated source")
+	flag.BoolVar(&profile, "profile", false, "report the calls and time for each function and line to stderr when the script finishes")
+	flag.BoolVar(&optimize, "optimize", false, "remove code that can never run, such as statements after a return, warning about each removal")
+	flag.StringVar(&modulePath, "path", "", "directories to search for imported files, separated by \""+string(os.PathListSeparator)+"\", before those in LOX_PATH")
+	flag.BoolVar(&werror, "werror", false, "treat warnings as errors, not running scripts that have any")
+	flag.BoolVar(&noColor, "no-color", false, "don't color errors, warnings and results, even on a terminal")
+	flag.BoolVar(&dumpAST, "ast", false, "print the script's parse tree as S-expressions instead of running it")
+	flag.Usage = func() {
+		fmt.Println("Usage: golox [flags] [script|- [args...]]")
+		fmt.Println("       golox --tokens|--ast script")
+		fmt.Println("       golox ast [--dot | --json] script")
+		fmt.Println("       golox [flags] -e source [args...]")
+		fmt.Println("       golox stats script")
+		fmt.Println("       golox check script...")
+		fmt.Println("       golox compile script [-o file]")
+		fmt.Println("       golox debug script")
+		fmt.Println("       golox fmt [-w | -d] script...")
+		fmt.Println("       golox lint [rule flags] script...")
+		fmt.Println("       golox bench [--runs n] [benchmark...]")
+		fmt.Println("       golox difftest [--reference cmd] dir")
+		fmt.Println("       golox test [-v] [-run regexp] [file_test.lox | dir]...")
+		fmt.Println("       golox test-suite [-v] dir")
+		fmt.Println("       golox golden [--update] [--format sexpr|json] dir")
+		fmt.Println("       golox explain code")
+		flag.PrintDefaults()
+	}
+	parseFlags(flag.CommandLine, os.Args[1:])
+	options.DisableAssertions = !assertions
+	options.ModulePath = append(filepath.SplitList(modulePath), filepath.SplitList(os.Getenv("LOX_PATH"))...)
+	detectColor()
+	handleInterrupts()
+
+	if inlineSource != "" {
+		runInline(inlineSource, flag.Args())
+	} else if flag.Arg(0) == "stats" && flag.NArg() == 2 {
+		printStats(flag.Arg(1))
+	} else if flag.Arg(0) == "difftest" {
+		runDiffTest(flag.Args()[1:])
+	} else if flag.Arg(0) == "explain" && flag.NArg() == 2 {
+		explain(flag.Arg(1))
+	} else if flag.Arg(0) == "check" && flag.NArg() >= 2 {
+		runCheck(flag.Args()[1:])
+	} else if flag.Arg(0) == "compile" {
+		runCompile(flag.Args()[1:])
+	} else if flag.Arg(0) == "ast" {
+		runAST(flag.Args()[1:])
+	} else if flag.Arg(0) == "lint" {
+		runLint(flag.Args()[1:])
+	} else if flag.Arg(0) == "fmt" {
+		runFmt(flag.Args()[1:])
+	} else if flag.Arg(0) == "debug" {
+		runDebug(flag.Args()[1:])
+	} else if flag.Arg(0) == "bench" {
+		runBench(flag.Args()[1:])
+	} else if flag.Arg(0) == "test" {
+		runUnitTests(flag.Args()[1:])
+	} else if flag.Arg(0) == "test-suite" {
+		runTestSuite(flag.Args()[1:])
+	} else if flag.Arg(0) == "golden" {
+		runGolden(flag.Args()[1:])
+	} else if dumpTokens && flag.NArg() == 1 {
+		printTokens(flag.Arg(0))
+	} else if dumpAST && flag.NArg() == 1 {
+		printAST(flag.Arg(0), "sexpr")
+	} else if flag.Arg(0) == "stats" || flag.Arg(0) == "explain" || flag.Arg(0) == "check" || dumpTokens || dumpAST {
+		// one of the commands above, with the wrong number of arguments
+		flag.Usage()
+		os.Exit(exitUsage)
+	} else if flag.NArg() >= 1 {
+		runFile(flag.Arg(0), flag.Args()[1:])
+	} else if stdinPiped() {
+		runFile("-", nil)
 	} else {
 		runPrompt()
 	}
 }
 
-func runFile(path string) {
-	fmt.Println("runFile", path)
-	bytes, err := ioutil.ReadFile(path)
+// parseFlags parses the flags in args, exiting with exitUsage if they are wrong, after flags has printed why
+func parseFlags(flags *flag.FlagSet, args []string) {
+	flags.Init(flags.Name(), flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(exitUsage)
+	}
+}
+
+// readScript reads the script at path, or from stdin if path is "-"
+func readScript(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal, eg for cat script.lox | golox
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// runFile runs the script at path, or from stdin if path is "-", passing it args
+func runFile(path string, args []string) {
+	bytes, err := readScript(path)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(exitNoInput)
+	}
+	global := lox.NewEnvironment(options)
+	global.SetArgs(args)
+	if path != "-" {
+		global.SetScriptPath(path)
+	}
+	setRunning(global)
+	if trace {
+		global.SetTrace(os.Stderr)
+	}
+	if memProfile {
+		global.EnableMemProfile()
+	}
+	warnings := &warningPrinter{src: string(bytes)}
+	program, err := parseSource(path, string(bytes), warnings)
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitDataErr)
+	}
+	if werror && warnings.count > 0 {
+		os.Exit(exitDataErr)
+	}
+
+	var prof *profiler
+	var cov *coverage
+	hooks := []lox.Hooks{}
+	if profile {
+		prof = newProfiler()
+		hooks = append(hooks, prof.hooks())
+	}
+	if cover {
+		cov = newCoverage(path, string(bytes), program)
+		hooks = append(hooks, cov.hooks())
+	}
+	global.SetHooks(chainHooks(hooks...))
+
+	err = interpret(program, global)
+	if memProfile {
+		writeMemProfile(global)
+	}
+	if prof != nil {
+		prof.report(os.Stderr, string(bytes))
+	}
+	if cov != nil {
+		cov.report()
+	}
+	if exit, ok := err.(*lox.ExitError); ok {
+		os.Exit(exit.Code)
+	}
+	if interrupt, ok := err.(*lox.InterruptError); ok && interrupt.Cause == nil {
+		printError(err.Error())
+		os.Exit(130) // conventional status for termination by SIGINT
+	}
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitSoftware)
+	}
+}
+
+// chainHooks combines hooks so that each of them is called in turn, eg for --profile and --cover together
+func chainHooks(hooks ...lox.Hooks) lox.Hooks {
+	if len(hooks) == 1 {
+		return hooks[0]
+	}
+	chained := lox.Hooks{}
+	for _, h := range hooks {
+		h, prev := h, chained
+		if h.OnStatement != nil {
+			chained.OnStatement = func(stmt *lox.Node, env *lox.Environment) {
+				if prev.OnStatement != nil {
+					prev.OnStatement(stmt, env)
+				}
+				h.OnStatement(stmt, env)
+			}
+		}
+		if h.OnCall != nil {
+			chained.OnCall = func(name string, args []*lox.Node) {
+				if prev.OnCall != nil {
+					prev.OnCall(name, args)
+				}
+				h.OnCall(name, args)
+			}
+		}
+		if h.OnReturn != nil {
+			chained.OnReturn = func(name string, value *lox.Node) {
+				if prev.OnReturn != nil {
+					prev.OnReturn(name, value)
+				}
+				h.OnReturn(name, value)
+			}
+		}
+	}
+	return chained
+}
+
+// runInline runs source given with -e, passing it args, and prints the value of its last statement if that is an
+// expression, as the REPL does. The final semicolon may be left out, eg golox -e "2 * 21"
+func runInline(src string, args []string) {
+	src = completeLine(src)
+	// checked first for warnings, which can stop the program before it runs
+	warnings := &warningPrinter{src: src}
+	if _, err := parseSource("", src, warnings); err == nil && werror && warnings.count > 0 {
+		os.Exit(exitDataErr)
+	}
+
+	interp := lox.New(options)
+	interp.Global().SetArgs(args)
+	setRunning(interp.Global())
+	if trace {
+		interp.Global().SetTrace(os.Stderr)
+	}
+	result, err := evalLine(interp, src)
+	if exit, ok := err.(*lox.ExitError); ok {
+		os.Exit(exit.Code)
+	}
+	if interrupt, ok := err.(*lox.InterruptError); ok && interrupt.Cause == nil {
+		printError(err.Error())
+		os.Exit(130)
+	}
+	if err != nil {
+		printError(lox.FormatError(err, src))
+		os.Exit(exitStatus(err))
+	}
+	if result != nil && result.Type != lox.NilNT {
+		fmt.Println(colorize(colorResult, result.ToString()))
+	}
+}
+
+// exitStatus is the status to exit with after err stopped a script: exitDataErr if it couldn't be lexed, parsed or
+// resolved, exitNoInput if it couldn't be read, and exitSoftware if it failed while running
+func exitStatus(err error) int {
+	switch err.(type) {
+	case *lox.LexError, *lox.ParseError, lox.ParseErrors, *lox.ResolveError:
+		return exitDataErr
+	case *os.PathError:
+		return exitNoInput
+	}
+	return exitSoftware
+}
+
+// parseSource builds and resolves the AST for a script, sending any warnings to warnings, and with --optimize removes
+// code that can never run. Files ending in .sexpr hold an AST written by ToSExpression, eg by golox golden, and are loaded without lexing or parsing, as are scripts compiled by golox compile
+func parseSource(path string, src string, warnings lox.ErrorReporter) (*lox.Node, error) {
+	var program *lox.Node
+	var err error
+	if lox.IsCompiled([]byte(src)) {
+		// warnings were shown when it was compiled
+		program, err = lox.LoadCompiled([]byte(src))
+		if err != nil {
+			return nil, err
+		}
+		return program, lox.Resolve(program)
+	} else if strings.HasSuffix(path, ".sexpr") {
+		program, err = lox.FromSExpression(src)
+	} else {
+		var tokens []lox.Token
+		tokens, err = lox.LexReporting(src, warnings)
+		if err != nil {
+			return nil, err
+		}
+		program, err = lox.Parse(tokens)
+	}
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	if optimize {
+		program = lox.Optimize(program, options, warnings)
+	}
+	return program, lox.ResolveReporting(program, warnings)
+}
 
+// warningPrinter prints warnings about a script to stderr, in yellow on a terminal, and counts them for --werror. With
+// --werror they are printed as errors
+type warningPrinter struct {
+	src    string // the script, to show the line each warning is on
+	prefix string // printed before each warning, eg the script's path
+	count  int
+}
+
+func (w *warningPrinter) Report(diag lox.Diagnostic) {
+	if diag.Severity != lox.SeverityWarning {
+		return // errors are returned, and printed by the caller
+	}
+	w.count++
+	msg := w.prefix + lox.FormatError(diag.Err, w.src)
+	if werror {
+		printError(msg)
+	} else {
+		fmt.Fprintln(os.Stderr, colorize(colorWarning, msg))
+	}
+}
+
+func writeMemProfile(global *lox.Environment) {
+	fmt.Fprintln(os.Stderr, "\nMemory profile:")
+	global.WriteMemReport(os.Stderr)
+	if pprofPath == "" {
+		return
+	}
+	f, err := os.Create(pprofPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer f.Close()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// interpret runs program, stopping it once the --timeout flag's duration has passed
+func interpret(program *lox.Node, global *lox.Environment) error {
+	if timeout == 0 {
+		return program.Interpret(global)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return program.InterpretContext(ctx, global)
+}
+
+// explain prints the extended description of an error code, eg E0203
+func explain(code string) {
+	explanation, ok := lox.Explain(code)
+	if !ok {
+		printError(fmt.Sprintf("no such error code \"%s\"", code))
+		os.Exit(exitUsage)
+	}
+	fmt.Println(strings.ToUpper(code) + ": " + explanation)
+}
+
+// runCheck lexes, parses and resolves each script without running it, printing every error and warning found with the
+// script's path. If any script has errors, it exits with the status for the first, eg exitDataErr for a parsing error
+func runCheck(paths []string) {
+	status := 0
+	for _, path := range paths {
+		src, errs, warnings := checkScript(path)
+		for _, err := range errs {
+			printError(path + ": " + lox.FormatError(err, src))
+			if status == 0 {
+				status = exitStatus(err)
+			}
+		}
+		if werror && warnings > 0 && status == 0 {
+			status = exitDataErr
+		}
+	}
+	os.Exit(status)
+}
+
+// checkScript returns a script's source and its errors, and prints its warnings, returning how many there were.
+// Parsing carries on past errors, so they are all reported, but the program is only resolved once it parses, since
+// statements skipped over would make for misleading errors
+func checkScript(path string) (string, []error, int) {
+	bytes, err := readScript(path)
+	if err != nil {
+		return "", []error{err}, 0
+	}
+	warnings := &warningPrinter{src: string(bytes), prefix: path + ": "}
+	_, err = parseSource(path, string(bytes), warnings)
+	if errs, ok := err.(lox.ParseErrors); ok {
+		return string(bytes), errs, warnings.count
+	}
+	if err != nil {
+		return string(bytes), []error{err}, warnings.count
+	}
+	return string(bytes), nil, warnings.count
+}
+
+// printTokens lists a script's tokens with their types and where each starts, as line:column
+func printTokens(path string) {
+	bytes, err := readScript(path)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(exitNoInput)
+	}
 	tokens, err := lox.Lex(string(bytes))
+	for _, t := range tokens {
+		fmt.Printf("%d:%d\t%-14s %q\n", t.Line, t.Column, t.Type, t.Lexeme)
+	}
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitDataErr)
+	}
+}
+
+// runAST prints a script's parse tree, as S-expressions unless --dot or --json asks for a Graphviz graph or JSON
+func runAST(args []string) {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	dot := flags.Bool("dot", false, "print a graph in Graphviz's DOT language, eg to pipe into dot -Tsvg")
+	json := flags.Bool("json", false, "print the tree as JSON, as golden --format json does")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox ast [--dot | --json] script")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 || *dot && *json {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+	format := "sexpr"
+	if *dot {
+		format = "dot"
+	} else if *json {
+		format = "json"
+	}
+	printAST(flags.Arg(0), format)
+}
+
+// printAST prints a script's parse tree in one of the formats renderAST supports
+func printAST(path string, format string) {
+	ast, err := renderAST(path, format)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		printError(err.Error())
+		os.Exit(exitStatus(err))
 	}
+	fmt.Print(ast)
+}
 
+// printStats reports the size and shape of a script without running it
+func printStats(path string) {
+	bytes, err := readScript(path)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(exitNoInput)
+	}
+	tokens, err := lox.Lex(string(bytes))
+	if err != nil {
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitDataErr)
+	}
 	program, err := lox.Parse(tokens)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		printError(lox.FormatError(err, string(bytes)))
+		os.Exit(exitDataErr)
 	}
 
-	program.Interpret()
+	stats := lox.ComputeStats(tokens, program)
+	fmt.Printf("Tokens: %d\n", stats.Tokens)
+	tokenTypes := []lox.TokenType{}
+	for t := range stats.TokenCounts {
+		tokenTypes = append(tokenTypes, t)
+	}
+	sort.Slice(tokenTypes, func(i, j int) bool { return tokenTypes[i] < tokenTypes[j] })
+	for _, t := range tokenTypes {
+		fmt.Printf("\t%-14s %d\n", t, stats.TokenCounts[t])
+	}
+
+	fmt.Printf("Nodes: %d, nested at most %d deep\n", stats.Nodes, stats.MaxDepth)
+	nodeTypes := []lox.NodeType{}
+	for t := range stats.NodeCounts {
+		nodeTypes = append(nodeTypes, t)
+	}
+	sort.Slice(nodeTypes, func(i, j int) bool { return nodeTypes[i] < nodeTypes[j] })
+	for _, t := range nodeTypes {
+		fmt.Printf("\t%-14s %d\n", t, stats.NodeCounts[t])
+	}
+
+	fmt.Printf("Functions: %d\n", len(stats.Functions))
+	for _, f := range stats.Functions {
+		fmt.Printf("\t%s(%d params): %d nodes\n", f.Name, f.Params, f.Nodes)
+	}
 }
 
+// runPrompt reads and runs one line at a time, printing the value of each expression entered. Declarations are kept
+// for the following lines. A line leaving a brace, parenthesis, bracket or string open is continued on the next, after
+// a "..." prompt. Lines entered are saved to ~/.golox_history, to be recalled with the up arrow. Lines starting with
+// ":" are commands to the REPL itself, listed by :help
 func runPrompt() {
-	reader := bufio.NewReader(os.Stdin)
+	editor := newLineEditor(defaultHistoryPath())
+	session := lox.NewSession(options)
+	editor.complete = func(prefix string) []string {
+		return completions(prefix, session)
+	}
+	warnings := &warningPrinter{}
+	session.SetReporter(warnings)
 
 	for {
-		fmt.Print("> ")
-		line, err := reader.ReadString('\n')
-
-		tokens, err := lox.Lex(line)
+		line, err := editor.ReadLine("> ")
+		for err == nil && incomplete(line) {
+			var more string
+			more, err = editor.ReadLine("... ")
+			line += "\n" + more
+		}
+		if err == errLineCancelled {
+			continue
+		}
 		if err != nil {
-			fmt.Println(err)
+			// the end of the input, eg Ctrl+D, leaves the REPL as :quit does
+			endSession(session)
+			return
+		}
+		editor.AddHistory(line)
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			warnings.src = "" // warnings from :load aren't about the line typed
+			session = runCommand(strings.TrimSpace(line), session)
+			session.SetReporter(warnings)
 			continue
 		}
+		warnings.src = completeLine(line)
+
+		setRunning(session.Global())
+		result, err := evalLine(session, line)
+		setRunning(nil)
+		if exit, ok := err.(*lox.ExitError); ok {
+			os.Exit(exit.Code)
+		}
+		if _, ok := err.(*lox.RuntimeError); ok {
+			// the error may be in a function declared on an earlier line, so this line can't be shown for it
+			printError(err.Error())
+		} else if err != nil {
+			printError(lox.FormatError(err, warnings.src))
+		} else if result != nil && result.Type != lox.NilNT {
+			fmt.Println(colorize(colorResult, result.ToString()))
+		}
+	}
+}
 
-		program, err := lox.Parse(tokens)
+// replCommands describes the REPL's commands, for :help
+var replCommands = [][2]string{
+	{":help", "list these commands"},
+	{":env", "list the variables and functions declared in this session"},
+	{":load file.lox", "run a script, keeping its declarations in this session"},
+	{":reset", "start a new session, forgetting every declaration"},
+	{":quit", "leave the REPL"},
+}
+
+// runCommand runs a REPL command, returning the session to carry on with
+func runCommand(line string, session *lox.Interpreter) *lox.Interpreter {
+	fields := strings.Fields(line)
+	switch {
+	case fields[0] == ":help" && len(fields) == 1:
+		for _, c := range replCommands {
+			fmt.Printf("%-16s %s\n", c[0], c[1])
+		}
+	case fields[0] == ":env" && len(fields) == 1:
+		globals := session.Global().Values
+		names := []string{}
+		for name, val := range globals {
+			if val.Type != lox.CallableNT { // natives are always there
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s = %s\n", name, globals[name].ToString())
+		}
+	case fields[0] == ":load" && len(fields) == 2:
+		setRunning(session.Global())
+		_, err := session.EvalFile(fields[1])
+		setRunning(nil)
+		if exit, ok := err.(*lox.ExitError); ok {
+			os.Exit(exit.Code)
+		}
 		if err != nil {
-			fmt.Println(err)
-			continue
+			printError(err.Error())
 		}
+	case fields[0] == ":reset" && len(fields) == 1:
+		// the old session ends as it would on leaving the REPL, running its atExit() functions
+		endSession(session)
+		return lox.NewSession(options)
+	case fields[0] == ":quit" && len(fields) == 1:
+		endSession(session)
+		os.Exit(0)
+	default:
+		printError(fmt.Sprintf("unknown command \"%s\", type :help for a list of commands", line))
+	}
+	return session
+}
 
-		program.Interpret()
+// completions lists the keywords, declared names, and REPL commands starting with prefix, in alphabetical order
+func completions(prefix string, session *lox.Interpreter) []string {
+	words := lox.Keywords()
+	for name := range session.Global().Values {
+		words = append(words, name)
+	}
+	for _, c := range replCommands {
+		words = append(words, strings.Fields(c[0])[0])
 	}
+	sort.Strings(words)
+
+	matches := []string{}
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
 }
 
-func run(src string) error {
-	fmt.Print(src)
+// endSession runs the functions a session registered with atExit(), exiting if one of them calls exit()
+func endSession(session *lox.Interpreter) {
+	err := session.Close()
+	if exit, ok := err.(*lox.ExitError); ok {
+		os.Exit(exit.Code)
+	}
+	if err != nil {
+		printError(err.Error())
+	}
+}
+
+// incomplete reports whether src ends inside a string, or with more braces, parentheses or brackets opened than closed
+func incomplete(src string) bool {
+	tokens, err := lox.Lex(src)
+	if lexErr, ok := err.(*lox.LexError); ok {
+		return lexErr.Code == lox.E0102 // unterminated string
+	}
+	depth := 0
+	for _, tok := range tokens {
+		switch tok.Type {
+		case lox.LeftBrace, lox.LeftParen, lox.LeftBracket:
+			depth++
+		case lox.RightBrace, lox.RightParen, lox.RightBracket:
+			depth--
+		}
+	}
+	return depth > 0
+}
 
-	return nil
+// completeLine adds the semicolon a line may leave out, and trims the space around it
+func completeLine(line string) string {
+	line = strings.TrimSpace(line)
+	if line != "" && !strings.HasSuffix(line, ";") && !strings.HasSuffix(line, "}") {
+		line += ";"
+	}
+	return line
+}
+
+// evalLine runs a line typed into the REPL, or given with -e, stopping it once the --timeout flag's duration has
+// passed. A line holding a single expression or statement may leave out its final semicolon, eg 1 + 2
+func evalLine(session *lox.Interpreter, line string) (*lox.Node, error) {
+	line = completeLine(line)
+	if timeout == 0 {
+		return session.Eval(line)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return session.EvalContext(ctx, line)
 }
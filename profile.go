@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// how many of the slowest lines the profile lists
+const profileLines = 20
+
+// profiler counts the calls to each function and the statements run on each line of a script, and how long they took,
+// using lox.Hooks. A line's time runs from when one of its statements starts until the next statement starts, so it
+// doesn't include the statements nested inside, while a function's time includes everything it called
+type profiler struct {
+	funcs map[string]*profileStat
+	lines map[int]*profileStat
+
+	calls    []time.Time    // when each call in progress started, innermost last
+	active   map[string]int // how many calls to each function are in progress
+	line     int            // line of the statement running, whose time is still being counted
+	lineFrom time.Time
+}
+
+type profileStat struct {
+	hits int
+	time time.Duration
+}
+
+func newProfiler() *profiler {
+	return &profiler{funcs: map[string]*profileStat{}, lines: map[int]*profileStat{}, active: map[string]int{},
+		lineFrom: time.Now()}
+}
+
+func (p *profiler) hooks() lox.Hooks {
+	return lox.Hooks{
+		OnStatement: func(stmt *lox.Node, env *lox.Environment) {
+			if stmt.Line == 0 {
+				return // made by the parser, eg for a for loop, so its time goes to the line around it
+			}
+			p.endLine()
+			p.line = stmt.Line
+			p.lineStat(stmt.Line).hits++
+		},
+		OnCall: func(name string, args []*lox.Node) {
+			p.calls = append(p.calls, time.Now())
+			p.active[name]++
+		},
+		OnReturn: func(name string, value *lox.Node) {
+			start := p.calls[len(p.calls)-1]
+			p.calls = p.calls[:len(p.calls)-1]
+			p.active[name]--
+			stat := p.funcStat(name)
+			stat.hits++
+			if p.active[name] == 0 {
+				// only the outermost of recursive calls is timed, so the time isn't counted twice
+				stat.time += time.Since(start)
+			}
+		},
+	}
+}
+
+// endLine adds the time since the current line's statement started to the line
+func (p *profiler) endLine() {
+	now := time.Now()
+	if p.line != 0 {
+		p.lineStat(p.line).time += now.Sub(p.lineFrom)
+	}
+	p.lineFrom = now
+}
+
+func (p *profiler) lineStat(line int) *profileStat {
+	if p.lines[line] == nil {
+		p.lines[line] = &profileStat{}
+	}
+	return p.lines[line]
+}
+
+func (p *profiler) funcStat(name string) *profileStat {
+	if p.funcs[name] == nil {
+		p.funcs[name] = &profileStat{}
+	}
+	return p.funcs[name]
+}
+
+// report writes the functions called, slowest first, then the slowest lines with their source
+func (p *profiler) report(w io.Writer, src string) {
+	p.endLine()
+
+	fmt.Fprintln(w, "\nProfile, functions by total time, including the functions they call:")
+	names := []string{}
+	for name := range p.funcs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return p.funcs[names[i]].time > p.funcs[names[j]].time })
+	for _, name := range names {
+		stat := p.funcs[name]
+		fmt.Fprintf(w, "\t%12s %8d calls  %s()\n", stat.time.Round(time.Microsecond), stat.hits, name)
+	}
+
+	fmt.Fprintf(w, "Lines by time, up to %d:\n", profileLines)
+	lines := []int{}
+	for line := range p.lines {
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool { return p.lines[lines[i]].time > p.lines[lines[j]].time })
+	if len(lines) > profileLines {
+		lines = lines[:profileLines]
+	}
+	source := strings.Split(src, "\n")
+	for _, line := range lines {
+		stat := p.lines[line]
+		text := ""
+		if line <= len(source) && !lox.IsCompiled([]byte(src)) {
+			text = strings.TrimSpace(source[line-1])
+		}
+		fmt.Fprintf(w, "\t%12s %8d runs   %5d | %s\n", stat.time.Round(time.Microsecond), stat.hits, line, text)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// patterns for the expectations written in comments by the test files of Crafting Interpreters' official suite
+var (
+	expectOutput       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectRuntimeError = regexp.MustCompile(`// expect runtime error: (.+)`)
+	expectError        = regexp.MustCompile(`// (Error.*)`)
+	expectErrorAt      = regexp.MustCompile(`// \[((java|c) )?line (\d+)\] (Error.*)`)
+	// the first line of an error golox reports on stderr
+	errorHeader = regexp.MustCompile(`^\w+ error (\[\w+\] )?on line (\d+)`)
+)
+
+// suiteTimeout stops a test that runs longer than this, eg one stuck in a loop
+const suiteTimeout = "10s"
+
+// suiteTest is what a test file expects golox to do
+type suiteTest struct {
+	output       []string
+	errorLines   []int // lines with compile errors, which stop the script from running
+	runtimeError int   // line of the runtime error that stops the script, or 0
+	messages     []string
+}
+
+// runTestSuite runs every .lox file under a directory, eg the test directory of the Crafting Interpreters repository,
+// comparing what golox prints with the "// expect:" comments in each file, and checking it fails on the lines marked
+// with compile or runtime errors. golox words its errors differently from jlox and clox, so only their lines are
+// compared, and the expected messages are shown when a test fails
+func runTestSuite(args []string) {
+	flags := flag.NewFlagSet("test-suite", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "list every test run, not only those that fail")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox test-suite [-v] dir")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	scripts := []string{}
+	err = filepath.Walk(flags.Arg(0), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".lox") {
+			scripts = append(scripts, path)
+		}
+		return err
+	})
+	if err != nil {
+		printError(err.Error())
+		os.Exit(exitNoInput)
+	}
+	sort.Strings(scripts)
+
+	failed := 0
+	for _, script := range scripts {
+		test, err := readSuiteTest(script)
+		if err != nil {
+			printError(err.Error())
+			failed++
+			continue
+		}
+		if problems := test.check(self, script); len(problems) > 0 {
+			failed++
+			fmt.Printf("FAIL %s\n", script)
+			for _, p := range problems {
+				fmt.Printf("\t%s\n", p)
+			}
+		} else if *verbose {
+			fmt.Printf("ok   %s\n", script)
+		}
+	}
+
+	fmt.Printf("%d of %d tests passed\n", len(scripts)-failed, len(scripts))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readSuiteTest collects the expectations in a test file's comments
+func readSuiteTest(path string) (*suiteTest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	test := &suiteTest{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if m := expectOutput.FindStringSubmatch(text); m != nil {
+			test.output = append(test.output, m[1])
+		} else if m := expectRuntimeError.FindStringSubmatch(text); m != nil {
+			test.runtimeError = line
+			test.messages = append(test.messages, fmt.Sprintf("line %d: %s", line, m[1]))
+		} else if m := expectErrorAt.FindStringSubmatch(text); m != nil {
+			if m[2] == "c" {
+				continue // only clox reports this error
+			}
+			at, _ := strconv.Atoi(m[3])
+			test.errorLines = append(test.errorLines, at)
+			test.messages = append(test.messages, fmt.Sprintf("line %d: %s", at, m[4]))
+		} else if m := expectError.FindStringSubmatch(text); m != nil {
+			test.errorLines = append(test.errorLines, line)
+			test.messages = append(test.messages, fmt.Sprintf("line %d: %s", line, m[1]))
+		}
+	}
+	return test, scanner.Err()
+}
+
+// check runs a test file with golox, describing each way what it did differs from what the test expects
+func (test *suiteTest) check(golox string, script string) []string {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(golox, "--timeout", suiteTimeout, script)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Run()
+	status := cmd.ProcessState.ExitCode()
+
+	output := strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n")
+	errors := []string{}
+	reported := map[int]bool{} // lines golox reported errors on
+	if stderr.Len() > 0 {
+		errors = strings.Split(strings.TrimRight(stderr.String(), "\n"), "\n")
+	}
+	for _, line := range errors {
+		if m := errorHeader.FindStringSubmatch(line); m != nil {
+			at, _ := strconv.Atoi(m[2])
+			reported[at] = true
+		}
+	}
+
+	problems := []string{}
+	want := 0
+	if len(test.errorLines) > 0 {
+		want = exitDataErr
+	} else if test.runtimeError > 0 {
+		want = exitSoftware
+	}
+	if status != want {
+		problems = append(problems, fmt.Sprintf("exited with status %d, expected %d", status, want))
+	}
+	for _, line := range test.errorLines {
+		if !reported[line] {
+			problems = append(problems, fmt.Sprintf("no error reported on line %d", line))
+		}
+	}
+	if test.runtimeError > 0 && !reported[test.runtimeError] {
+		problems = append(problems, fmt.Sprintf("no runtime error reported on line %d", test.runtimeError))
+	}
+	if len(problems) > 0 && len(test.messages) > 0 {
+		problems = append(problems, "expected errors:")
+		for _, m := range test.messages {
+			problems = append(problems, "  "+m)
+		}
+	}
+	if len(problems) > 0 && len(errors) > 0 {
+		problems = append(problems, "golox reported:")
+		for _, line := range errors {
+			problems = append(problems, "  "+line)
+		}
+	}
+
+	if line, diff := firstDifference(strings.Join(test.output, "\n"), strings.Join(output, "\n")); diff != "" {
+		problems = append(problems, fmt.Sprintf("output differs at line %d:", line))
+		problems = append(problems, strings.Split(strings.TrimRight(diff, "\n"), "\n")...)
+	}
+	return problems
+}
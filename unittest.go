@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jheredos/golox/lox"
+)
+
+// unitTest is a test registered by a test file calling test(name, fn)
+type unitTest struct {
+	name string
+	fn   *lox.Node
+}
+
+// runUnitTests runs the tests in Lox test files: those named, or every file ending in _test.lox under the directories
+// named, or under the current directory. A test file declares tests by calling test(name, fn) with a function taking no
+// arguments, which fails if it stops with a runtime error, eg from a failed assert()
+func runUnitTests(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	run := flags.String("run", "", "only run tests whose names match this regular expression")
+	verbose := flags.Bool("v", false, "list every test run and show what each printed, not only failures")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox test [-v] [-run regexp] [file_test.lox | dir]...")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		printError("-run: " + err.Error())
+		os.Exit(exitUsage)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(exitNoInput)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.HasSuffix(file, "_test.lox") {
+				files = append(files, file)
+			}
+			return err
+		})
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		printError("no test files found")
+		os.Exit(exitNoInput)
+	}
+
+	failed := false
+	for _, file := range files {
+		if !runTestFile(file, filter, *verbose) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runTestFile runs a test file's top-level code, then each of the tests it registered that match filter, reporting
+// whether they all passed
+func runTestFile(path string, filter *regexp.Regexp, verbose bool) bool {
+	start := time.Now()
+	script, err := readScript(path)
+	if err != nil {
+		printError(err.Error())
+		return false
+	}
+	src := string(script)
+	program, err := parseSource(path, src, &warningPrinter{src: src, prefix: path + ": "})
+	if err != nil {
+		printError(path + ": " + lox.FormatError(err, src))
+		fmt.Printf("FAIL %s\n", path)
+		return false
+	}
+
+	tests := []unitTest{}
+	var output bytes.Buffer // what the test being run printed, shown if it fails or with -v
+	global := lox.NewEnvironment(options)
+	global.SetStdout(&output)
+	global.SetScriptPath(path)
+	global.RegisterNative("test", 2, func(args []*lox.Node) (*lox.Node, error) {
+		if args[0].Type != lox.StringNT {
+			return nil, fmt.Errorf("expects the test's name as a string, got %s", args[0].ToString())
+		}
+		if args[1].Type != lox.FunctionNT {
+			return nil, fmt.Errorf("expects a function running the test, got %s", args[1].ToString())
+		}
+		tests = append(tests, unitTest{args[0].Data.String(), args[1]})
+		return nil, nil
+	})
+	setRunning(global)
+	if err := interpret(program, global); err != nil {
+		fmt.Print(output.String())
+		printError(path + ": " + lox.FormatError(err, src))
+		fmt.Printf("FAIL %s\n", path)
+		return false
+	}
+
+	passed, ran := 0, 0
+	for _, test := range tests {
+		if !filter.MatchString(test.name) {
+			continue
+		}
+		ran++
+		output.Reset()
+		testStart := time.Now()
+		_, err := global.Call(test.fn)
+		elapsed := time.Since(testStart).Seconds()
+		if err == nil {
+			passed++
+			if verbose {
+				fmt.Printf("--- PASS: %s (%.2fs)\n", test.name, elapsed)
+				fmt.Print(indent(output.String()))
+			}
+			continue
+		}
+		fmt.Printf("--- FAIL: %s (%.2fs)\n", test.name, elapsed)
+		fmt.Print(indent(output.String()))
+		if exit, ok := err.(*lox.ExitError); ok {
+			fmt.Print(indent(fmt.Sprintf("called exit(%d)\n", exit.Code)))
+		} else {
+			fmt.Print(indent(lox.FormatError(err, src) + "\n"))
+		}
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if passed < ran {
+		fmt.Printf("FAIL %s\t%d of %d tests failed (%.2fs)\n", path, ran-passed, ran, elapsed)
+		return false
+	}
+	fmt.Printf("ok   %s\t%d tests (%.2fs)\n", path, ran, elapsed)
+	return true
+}
+
+// indent puts each line of text under the test it belongs to
+func indent(text string) string {
+	if text == "" {
+		return ""
+	}
+	return "    " + strings.Replace(strings.TrimSuffix(text, "\n"), "\n", "\n    ", -1) + "\n"
+}